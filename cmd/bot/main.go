@@ -1,13 +1,31 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 
+	"carlospayan/agent-comercial-ai/internal/cache"
 	"carlospayan/agent-comercial-ai/internal/catalog"
 	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/conversation"
+	"carlospayan/agent-comercial-ai/internal/critique"
+	"carlospayan/agent-comercial-ai/internal/customer"
+	"carlospayan/agent-comercial-ai/internal/experiments"
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/grounding"
+	"carlospayan/agent-comercial-ai/internal/guard"
 	"carlospayan/agent-comercial-ai/internal/handlers"
+	"carlospayan/agent-comercial-ai/internal/intent"
+	"carlospayan/agent-comercial-ai/internal/llm"
+	"carlospayan/agent-comercial-ai/internal/media"
+	"carlospayan/agent-comercial-ai/internal/prompts"
+	"carlospayan/agent-comercial-ai/internal/speech"
+	"carlospayan/agent-comercial-ai/internal/store"
+	"carlospayan/agent-comercial-ai/internal/tradein"
+	"carlospayan/agent-comercial-ai/internal/usage"
 	"carlospayan/agent-comercial-ai/internal/utils"
+	"carlospayan/agent-comercial-ai/internal/vision"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
@@ -22,22 +40,115 @@ func main() {
 		log.Fatalf("error loading config: %v", err)
 	}
 
-	kavakURL := "https://www.kavak.com/mx/blog/sedes-de-kavak-en-mexico"
-	content, err := utils.FetchKavakInfo(kavakURL)
+	content, err := utils.FetchKavakInfo(cfg.Kavak.InfoURL)
 	if err != nil {
 		log.Fatalf("couldn't extract info from Kavak: %v", err)
 	}
 
+	usage.Configure(cfg.Pricing)
+
+	lib, err := prompts.Load(cfg.Prompts, prompts.Data{
+		KavakInfoURL: cfg.Kavak.InfoURL,
+		Branches:     cfg.Kavak.Branches,
+		Financing:    cfg.Financing,
+	})
+	if err != nil {
+		log.Fatalf("error loading prompts: %v", err)
+	}
+	log.Printf("Using prompt version %s (available: %v)", lib.Default(), lib.Versions())
+
+	model := cfg.OpenAI.Model
+	if model == "" {
+		model = llm.DefaultModel
+	}
+	exp := experiments.New(cfg.Experiment, experiments.Variant{
+		PromptVersion: lib.Default(),
+		Model:         model,
+		TopN:          3,
+	})
+
 	cat, err := catalog.NewCatalog(cfg.OpenAI.APIKey, cfg.Catalog.Path)
 	if err != nil {
 		log.Fatalf("error cargando catálogo: %v", err)
 	}
 
+	client := llm.NewClient(cfg.OpenAI.APIKey)
+
+	rules := []guard.Rule{guard.InjectionRule(), guard.AbuseRule(), guard.NewSpamRule(cfg.Guard.MaxLength)}
+	if cfg.Guard.Moderation {
+		rules = append(rules, guard.NewModerationRule(client))
+	}
+
+	responseCache := cache.New(cfg.Cache)
+
+	calc := financing.New(cfg.Financing)
+
+	sessions, err := store.New(cfg.Store)
+	if err != nil {
+		log.Fatalf("error opening session store: %v", err)
+	}
+
+	engine := conversation.New(conversation.Deps{
+		Client:        client,
+		Sessions:      sessions,
+		Expiry:        cfg.Store.Expiry,
+		KavakInfo:     content,
+		Catalog:       cat,
+		Prompts:       lib,
+		Experiment:    exp,
+		Grounding:     grounding.NewChecker(cfg.Grounding, cat.Cars()),
+		Critique:      critique.NewChecker(cfg.Critique, calc),
+		Financing:     calc,
+		TradeIn:       tradein.New(cfg.TradeIn, cat.Cars()),
+		TradeInParser: tradein.NewParser(cat.Cars()),
+		Media:         media.NewFetcher(cfg.Media, cfg.Twilio),
+		Vision:        vision.NewDescriber(cfg.Vision, client),
+		Speech:        speech.New(cfg.Speech, client),
+		Guard:         guard.New(cfg.Guard, rules...),
+		Cache:         responseCache,
+		Intents:       intent.NewClassifier(cfg.Intent, client),
+		Structured:    cfg.Structured,
+		Concurrency:   cfg.Concurrency,
+		Profiles:      cfg.Profiles,
+		Preferences:   customer.NewExtractor(cat),
+	})
+
+	go engine.RunJanitor(context.Background())
+	go engine.RefreshKavakInfo(context.Background(), cfg.Kavak.InfoRefresh, func() (string, error) {
+		return utils.FetchKavakInfo(cfg.Kavak.InfoURL)
+	})
+
 	r := chi.NewRouter()
 
-	r.Get("/qa", handlers.RAGHandler(cfg, content, cat))
+	r.Get("/qa", handlers.RAGHandler(engine))
+
+	r.Post("/whatsapp", handlers.WhatsAppHandler(engine, cfg.Server.PublicURL))
+
+	chat := handlers.ChatHandler(engine)
+	r.Get("/v1/chat", chat)
+	r.Post("/v1/chat", chat)
+
+	stream := handlers.ChatStreamHandler(engine)
+	r.Get("/v1/chat/stream", stream)
+	r.Post("/v1/chat/stream", stream)
+
+	r.Get("/v1/profile", handlers.ProfileHandler(sessions))
+	r.Delete("/v1/profile", handlers.DeleteProfileHandler(sessions))
+
+	r.Post("/v1/financing/simulate", handlers.FinancingSimulateHandler(cat, calc))
+	r.Get("/v1/financing/quote", handlers.FinancingQuoteHandler(cat, calc))
+
+	r.Get("/v1/cars/compare", handlers.CompareHandler(cat, calc, sessions))
 
-	r.Post("/whatsapp", handlers.WhatsAppHandler(cfg, content, cat))
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(handlers.RequireAdmin(cfg.Admin.Token))
+		r.Get("/experiments", handlers.ExperimentsHandler(exp))
+		r.Post("/cache/invalidate", handlers.CacheInvalidateHandler(responseCache))
+		r.Get("/sessions/{sessionID}", handlers.SessionHandler(sessions, cat))
+		r.Get("/sessions/{sessionID}/usage", handlers.UsageHandler(sessions))
+		r.Get("/profiles/{customerID}", handlers.CustomerProfileHandler(sessions))
+		r.Delete("/profiles/{customerID}", handlers.DeleteCustomerProfileHandler(sessions))
+	})
 
 	r.Handle("/metrics", promhttp.Handler())
 
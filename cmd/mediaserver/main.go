@@ -0,0 +1,51 @@
+// Command mediaserver stands in for Twilio's media host during local
+// testing: it serves the files of a directory so that /whatsapp can be called
+// with MediaUrl0 pointing at it. The bot only fetches it with
+// media.allow_any_host enabled.
+//
+//	go run ./cmd/mediaserver -dir ./photos
+//	curl -X POST localhost:8080/whatsapp -d From=whatsapp:+5215500000000 \
+//	  -d MediaUrl0=http://localhost:9090/jetta.jpg -d MediaContentType0=image/jpeg
+//
+// /large?mb=N answers N megabytes of filler to check the download limit.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "address to listen on")
+	dir := flag.String("dir", ".", "directory with the media files")
+	flag.Parse()
+
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.Dir(*dir)))
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		mb, err := strconv.Atoi(r.URL.Query().Get("mb"))
+		if err != nil || mb <= 0 {
+			mb = 10
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		chunk := []byte(strings.Repeat("\x00", 1<<20))
+		for i := 0; i < mb; i++ {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	})
+
+	log.Printf("Serving media from %s on %s", *dir, *addr)
+	log.Fatal(http.ListenAndServe(*addr, logRequests(mux)))
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+)
+
+type entry struct {
+	scope     string
+	embedding []float32
+	answer    string
+	// expires is zero for entries that never expire.
+	expires time.Time
+}
+
+// Cache stores answers to general questions and serves them to later
+// questions whose embedding is similar enough. Entries are scoped (by
+// experiment variant and prompt version) so that answers produced under one
+// configuration are never served under another.
+type Cache struct {
+	enabled    bool
+	ttl        time.Duration
+	similarity float32
+	maxEntries int
+
+	mu        sync.Mutex
+	knowledge string
+	entries   []entry
+}
+
+func New(cfg config.CacheConfig) *Cache {
+	return &Cache{
+		enabled:    cfg.Enabled,
+		ttl:        cfg.TTL,
+		similarity: cfg.Similarity,
+		maxEntries: cfg.MaxEntries,
+	}
+}
+
+func (c *Cache) Enabled() bool {
+	return c != nil && c.enabled
+}
+
+// SetKnowledge drops every entry when the knowledge base the answers were
+// built from (the Kavak info, branches, prompt...) changes. fingerprint is
+// any string that changes along with it.
+func (c *Cache) SetKnowledge(fingerprint string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.knowledge != fingerprint {
+		c.knowledge = fingerprint
+		c.entries = nil
+	}
+}
+
+// Invalidate drops every entry and returns how many there were.
+func (c *Cache) Invalidate() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries = nil
+	return n
+}
+
+// Get returns the cached answer most similar to embedding within scope.
+func (c *Cache) Get(scope string, embedding []float32) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	live := c.entries[:0]
+	var best string
+	var bestScore float32
+	for _, e := range c.entries {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			continue
+		}
+		live = append(live, e)
+		if e.scope != scope {
+			continue
+		}
+		if score := catalog.Cosine(embedding, e.embedding); score >= c.similarity && score > bestScore {
+			best, bestScore = e.answer, score
+		}
+	}
+	c.entries = live
+
+	if best == "" {
+		metrics.CacheLookups.WithLabelValues("miss").Inc()
+		return "", false
+	}
+	metrics.CacheLookups.WithLabelValues("hit").Inc()
+	return best, true
+}
+
+func (c *Cache) Put(scope string, embedding []float32, answer string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.entries = c.entries[1:]
+	}
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+	c.entries = append(c.entries, entry{
+		scope:     scope,
+		embedding: embedding,
+		answer:    answer,
+		expires:   expires,
+	})
+	metrics.CacheEntries.Set(float64(len(c.entries)))
+}
+
+// Skip counts a lookup that wasn't attempted because the answer depends on
+// the session.
+func (c *Cache) Skip() {
+	metrics.CacheLookups.WithLabelValues("skip").Inc()
+}
@@ -7,11 +7,14 @@ import (
 	"io"
 	"math"
 	"os"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/usage"
 )
 
 type Car struct {
@@ -33,6 +36,8 @@ type Car struct {
 type Catalog struct {
 	client *openai.Client
 	cars   []Car
+	// makes matches the names of the makes in the catalog.
+	makes *regexp.Regexp
 }
 
 func NewCatalog(apiKey, path string) (*Catalog, error) {
@@ -99,17 +104,41 @@ func NewCatalog(apiKey, path string) (*Catalog, error) {
 		if err != nil {
 			return nil, fmt.Errorf("error calculating embedding for %s %s: %w", car.Make, car.Model, err)
 		}
+		usage.Record(context.Background(), string(openai.AdaEmbeddingV2), resp.Usage.PromptTokens, 0)
 		car.Embedding = resp.Data[0].Embedding
 		cars = append(cars, car)
 	}
 
+	return New(cli, cars), nil
+}
+
+// New returns the catalog of cars, whose embeddings are already computed;
+// client embeds the queries.
+func New(client *openai.Client, cars []Car) *Catalog {
 	return &Catalog{
-		client: cli,
+		client: client,
 		cars:   cars,
-	}, nil
+		makes:  makesRegexp(cars),
+	}
+}
+
+// ByStockID returns the car with the given stock ID.
+func (c *Catalog) ByStockID(stockID string) (Car, bool) {
+	for _, car := range c.cars {
+		if car.StockID == stockID {
+			return car, true
+		}
+	}
+	return Car{}, false
+}
+
+// Cars returns every car in the catalog.
+func (c *Catalog) Cars() []Car {
+	return c.cars
 }
 
-func cosine(a, b []float32) float32 {
+// Cosine returns the cosine similarity of two embeddings.
+func Cosine(a, b []float32) float32 {
 	var dot, normaA, normaB float32
 	for i := range a {
 		dot += a[i] * b[i]
@@ -119,7 +148,8 @@ func cosine(a, b []float32) float32 {
 	return dot / (float32(math.Sqrt(float64(normaA))) * float32(math.Sqrt(float64(normaB))))
 }
 
-func (c *Catalog) Search(ctx context.Context, query string, topN int) ([]Car, error) {
+// Embed returns the embedding of query, as used by Search.
+func (c *Catalog) Embed(ctx context.Context, query string) ([]float32, error) {
 	resp, err := c.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
 		Model: openai.AdaEmbeddingV2,
 		Input: []string{query},
@@ -127,8 +157,26 @@ func (c *Catalog) Search(ctx context.Context, query string, topN int) ([]Car, er
 	if err != nil {
 		return nil, fmt.Errorf("error calculating embedding for query: %w", err)
 	}
-	qEmb := resp.Data[0].Embedding
+	usage.Record(ctx, string(openai.AdaEmbeddingV2), resp.Usage.PromptTokens, 0)
+	return resp.Data[0].Embedding, nil
+}
+
+func (c *Catalog) Search(ctx context.Context, query string, topN int) ([]Car, error) {
+	qEmb, err := c.Embed(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return c.SearchEmbedding(qEmb, topN), nil
+}
+
+// SearchEmbedding ranks the catalog against an embedding from Embed.
+func (c *Catalog) SearchEmbedding(qEmb []float32, topN int) []Car {
+	return c.SearchFiltered(qEmb, topN, Filter{})
+}
 
+// SearchFiltered ranks the cars that pass filter against an embedding from
+// Embed.
+func (c *Catalog) SearchFiltered(qEmb []float32, topN int, filter Filter) []Car {
 	type scoredCar struct {
 		Car
 		Score float32
@@ -137,7 +185,10 @@ func (c *Catalog) Search(ctx context.Context, query string, topN int) ([]Car, er
 	scoredList = make([]scoredCar, 0, len(c.cars))
 
 	for _, car := range c.cars {
-		sim := cosine(qEmb, car.Embedding)
+		if !filter.Match(car) {
+			continue
+		}
+		sim := Cosine(qEmb, car.Embedding)
 		scoredList = append(scoredList, scoredCar{
 			Car:   car,
 			Score: sim,
@@ -156,5 +207,76 @@ func (c *Catalog) Search(ctx context.Context, query string, topN int) ([]Car, er
 	for i := 0; i < limit; i++ {
 		result = append(result, scoredList[i].Car)
 	}
-	return result, nil
+	return result
+}
+
+// Filter narrows a search. Zero fields don't filter.
+type Filter struct {
+	Make     string
+	MaxPrice float64
+	MinYear  int
+	MaxKM    int
+}
+
+// Match reports whether car passes the filter.
+func (f Filter) Match(car Car) bool {
+	switch {
+	case f.Make != "" && !strings.EqualFold(car.Make, f.Make):
+		return false
+	case f.MaxPrice > 0 && car.Price > f.MaxPrice:
+		return false
+	case f.MinYear > 0 && car.Year < f.MinYear:
+		return false
+	case f.MaxKM > 0 && car.KM > f.MaxKM:
+		return false
+	}
+	return true
+}
+
+var (
+	minYearRe = regexp.MustCompile(`\b(?:desde|a partir del?|from|since|a partir de) (\d{4})\b|\b(\d{4}) (?:o|or|ou) (?:mas nuev[oa]|mas reciente|newer|mais nov[oa])\b|\b(\d{4}) en adelante\b`)
+	maxKMRe   = regexp.MustCompile(`\b(?:menos de|maximo|hasta|under|less than|at most|ate|no maximo) (\d{1,3}(?:[,.]\d{3})+|\d+)\s*(mil\s*)?(?:km|kms|kilometros|kilometers|quilometros)\b`)
+	accents   = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ñ", "n", "ã", "a", "õ", "o", "ç", "c", "ê", "e", "ô", "o")
+)
+
+// ParseFilter reads the make, minimum year and maximum mileage a message
+// asks for, like "un Mazda 2018 o más nuevo con menos de 80,000 km". Makes
+// are the ones in the catalog.
+func (c *Catalog) ParseFilter(text string) Filter {
+	t := accents.Replace(strings.ToLower(text))
+	var f Filter
+	if m := c.makes.FindString(t); m != "" {
+		for _, car := range c.cars {
+			if accents.Replace(strings.ToLower(strings.TrimSpace(car.Make))) == m {
+				f.Make = car.Make
+				break
+			}
+		}
+	}
+	if m := minYearRe.FindStringSubmatch(t); m != nil {
+		f.MinYear, _ = strconv.Atoi(m[1] + m[2] + m[3])
+	}
+	if m := maxKMRe.FindStringSubmatch(t); m != nil {
+		f.MaxKM, _ = strconv.Atoi(strings.NewReplacer(",", "", ".", "").Replace(m[1]))
+		if m[2] != "" {
+			f.MaxKM *= 1000
+		}
+	}
+	return f
+}
+
+func makesRegexp(cars []Car) *regexp.Regexp {
+	seen := make(map[string]bool)
+	var names []string
+	for _, car := range cars {
+		name := strings.ToLower(strings.TrimSpace(car.Make))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, regexp.QuoteMeta(accents.Replace(name)))
+		}
+	}
+	if len(names) == 0 {
+		return regexp.MustCompile(`$^`)
+	}
+	return regexp.MustCompile(`\b(` + strings.Join(names, "|") + `)\b`)
 }
@@ -0,0 +1,191 @@
+package compare
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/financing"
+)
+
+const (
+	MinCars = 2
+	MaxCars = 4
+)
+
+var (
+	ErrTooFew  = fmt.Errorf("compare at least %d cars", MinCars)
+	ErrTooMany = fmt.Errorf("compare at most %d cars", MaxCars)
+)
+
+// NotFoundError is returned when a car to compare isn't in the catalog.
+type NotFoundError struct {
+	Ref string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("car %q not found", e.Ref)
+}
+
+// Car is one column of a comparison.
+type Car struct {
+	StockID   string  `json:"stock_id"`
+	Make      string  `json:"make"`
+	Model     string  `json:"model"`
+	Version   string  `json:"version"`
+	Year      int     `json:"year"`
+	Price     float64 `json:"price"`
+	KM        int     `json:"km"`
+	Length    float64 `json:"length_mm"`
+	Width     float64 `json:"width_mm"`
+	Height    float64 `json:"height_mm"`
+	Bluetooth bool    `json:"bluetooth"`
+	CarPlay   bool    `json:"carplay"`
+	// MonthlyPayment is the estimated monthly payment including insurance;
+	// 0 when the car can't be financed with the assumed terms.
+	MonthlyPayment float64 `json:"monthly_payment"`
+	DownPayment    float64 `json:"down_payment"`
+	AnnualRate     float64 `json:"annual_rate"`
+	CAT            float64 `json:"cat"`
+}
+
+// Comparison puts two to four cars side by side.
+type Comparison struct {
+	Cars []Car `json:"cars"`
+	// Years and Profile are the financing terms the payments assume.
+	Years   int               `json:"years"`
+	Profile financing.Profile `json:"profile,omitempty"`
+	// Best holds the stock ID that wins each criterion: lowest_price,
+	// lowest_km, newest, lowest_payment and largest.
+	Best map[string]string `json:"best"`
+}
+
+// Resolve finds the cars refs point to. A ref is a stock ID or a make and
+// model like "Mazda 3"; names are looked up in recent first, then in the
+// catalog.
+func Resolve(cat *catalog.Catalog, recent []catalog.Car, refs []string) ([]catalog.Car, error) {
+	var cars []catalog.Car
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		car, ok := cat.ByStockID(ref)
+		if !ok {
+			if car, ok = byName(recent, ref); !ok {
+				car, ok = byName(cat.Cars(), ref)
+			}
+		}
+		if !ok {
+			return nil, &NotFoundError{Ref: ref}
+		}
+		if !seen[car.StockID] {
+			seen[car.StockID] = true
+			cars = append(cars, car)
+		}
+	}
+	return cars, nil
+}
+
+// byName returns the first car whose make and model contain every word of
+// name.
+func byName(cars []catalog.Car, name string) (catalog.Car, bool) {
+	words := strings.Fields(strings.ToLower(name))
+	for _, car := range cars {
+		full := strings.ToLower(car.Make + " " + car.Model + " " + car.Version)
+		all := true
+		for _, w := range words {
+			all = all && strings.Contains(full, w)
+		}
+		if all {
+			return car, true
+		}
+	}
+	return catalog.Car{}, false
+}
+
+// Compare builds the comparison of cars, estimating each monthly payment
+// with terms. Without a down payment in terms, the configured estimate
+// fraction of each price is assumed.
+func Compare(cars []catalog.Car, calc *financing.Calculator, terms financing.Terms) (Comparison, error) {
+	switch {
+	case len(cars) < MinCars:
+		return Comparison{}, ErrTooFew
+	case len(cars) > MaxCars:
+		return Comparison{}, ErrTooMany
+	}
+
+	cfg := calc.Config()
+	years := terms.Years
+	if years == 0 {
+		years = cfg.DefaultYears
+	}
+	c := Comparison{Years: years, Profile: terms.Profile, Best: make(map[string]string)}
+	for _, car := range cars {
+		col := Car{
+			StockID:   car.StockID,
+			Make:      car.Make,
+			Model:     car.Model,
+			Version:   car.Version,
+			Year:      car.Year,
+			Price:     car.Price,
+			KM:        car.KM,
+			Length:    car.Lenght,
+			Width:     car.Widht,
+			Height:    car.Height,
+			Bluetooth: yes(car.Bluetooth),
+			CarPlay:   yes(car.CarPlay),
+		}
+		down := terms.TotalDownPayment()
+		if down == 0 {
+			down = car.Price * math.Max(cfg.EstimateDownPayment, cfg.MinDownPayment)
+		}
+		// Terms that don't apply to a car, like a down payment above its
+		// price, leave its payment out.
+		if plan, err := calc.SimulateProfile(terms.Profile, car.Price, down, years); err == nil {
+			col.MonthlyPayment = plan.MonthlyTotal()
+			col.DownPayment = plan.DownPayment
+			col.AnnualRate = plan.AnnualRate
+			col.CAT = plan.CAT
+		}
+		c.Cars = append(c.Cars, col)
+	}
+
+	c.best("lowest_price", func(a, b Car) bool { return a.Price < b.Price })
+	c.best("lowest_km", func(a, b Car) bool { return a.KM < b.KM })
+	c.best("newest", func(a, b Car) bool { return a.Year > b.Year })
+	c.best("lowest_payment", func(a, b Car) bool {
+		return a.MonthlyPayment > 0 && (b.MonthlyPayment == 0 || a.MonthlyPayment < b.MonthlyPayment)
+	})
+	c.best("largest", func(a, b Car) bool { return a.Length*a.Width*a.Height > b.Length*b.Width*b.Height })
+	return c, nil
+}
+
+// best records the car that beats every other under better. Ties have no
+// winner.
+func (c *Comparison) best(criterion string, better func(a, b Car) bool) {
+	winner := -1
+	for i, car := range c.Cars {
+		wins := true
+		for j, other := range c.Cars {
+			if i != j && !better(car, other) {
+				wins = false
+				break
+			}
+		}
+		if wins {
+			winner = i
+			break
+		}
+	}
+	if winner >= 0 {
+		c.Best[criterion] = c.Cars[winner].StockID
+	}
+}
+
+func yes(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return s != "" && s != "no"
+}
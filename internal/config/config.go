@@ -1,13 +1,27 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
 
 type ServerConfig struct {
 	Address string `mapstructure:"address"`
+	// PublicURL is where users reach the server, for links sent over
+	// WhatsApp (e.g. financing quotes). Empty disables those links.
+	PublicURL string `mapstructure:"public_url"`
+}
+
+type AdminConfig struct {
+	// Token is the bearer token the /admin routes require; empty disables
+	// them.
+	Token string `mapstructure:"token"`
 }
 
 type OpenAIConfig struct {
 	APIKey string `mapstructure:"api_key"`
+	Model  string `mapstructure:"model"`
 }
 
 type CatalogConfig struct {
@@ -20,11 +34,273 @@ type TwilioConfig struct {
 	WhatsAppFrom string `mapstructure:"whatsapp_from"`
 }
 
+type BranchConfig struct {
+	Name  string `mapstructure:"name"`
+	Hours string `mapstructure:"hours"`
+}
+
+type KavakConfig struct {
+	InfoURL string `mapstructure:"info_url"`
+	// InfoRefresh is how often the info at InfoURL is fetched again; 0
+	// fetches it only at startup.
+	InfoRefresh time.Duration  `mapstructure:"info_refresh"`
+	Branches    []BranchConfig `mapstructure:"branches"`
+}
+
+type FinancingConfig struct {
+	AnnualRate   float64 `mapstructure:"annual_rate"`
+	MinYears     int     `mapstructure:"min_years"`
+	MaxYears     int     `mapstructure:"max_years"`
+	DefaultYears int     `mapstructure:"default_years"`
+	// MinDownPayment is the smallest down payment as a fraction of the
+	// price; 0 allows financing the whole price.
+	MinDownPayment float64 `mapstructure:"min_down_payment"`
+	// EstimateDownPayment is the down payment, as a fraction of the price,
+	// assumed for estimated payments when the customer hasn't given one.
+	EstimateDownPayment float64 `mapstructure:"estimate_down_payment"`
+	// Tiers are tried in order; the first one that matches the customer's
+	// credit profile, down payment and term sets the rate. AnnualRate is
+	// used when none matches.
+	Tiers []RateTierConfig `mapstructure:"tiers"`
+	// OpeningCommission is charged once, as a fraction of the financed
+	// amount.
+	OpeningCommission float64 `mapstructure:"opening_commission"`
+	// InsuranceRate is the yearly car insurance as a fraction of the price,
+	// paid monthly with the loan.
+	InsuranceRate float64 `mapstructure:"insurance_rate"`
+	// IVA is the value-added tax charged on interest.
+	IVA float64 `mapstructure:"iva"`
+}
+
+type RateTierConfig struct {
+	Name string `mapstructure:"name"`
+	// Profile is the self-declared credit profile (excellent, good, fair,
+	// limited); empty matches any profile, including an unknown one.
+	Profile string `mapstructure:"profile"`
+	// MinDownPayment is the smallest down payment for the tier, as a
+	// fraction of the price.
+	MinDownPayment float64 `mapstructure:"min_down_payment"`
+	// MaxYears is the longest term for the tier; 0 means any.
+	MaxYears   int     `mapstructure:"max_years"`
+	AnnualRate float64 `mapstructure:"annual_rate"`
+}
+
+type PromptsConfig struct {
+	Dir     string `mapstructure:"dir"`
+	Version string `mapstructure:"version"`
+}
+
+type VariantConfig struct {
+	Name          string `mapstructure:"name"`
+	Weight        int    `mapstructure:"weight"`
+	PromptVersion string `mapstructure:"prompt_version"`
+	Model         string `mapstructure:"model"`
+	TopN          int    `mapstructure:"top_n"`
+}
+
+type ExperimentConfig struct {
+	Name     string          `mapstructure:"name"`
+	Variants []VariantConfig `mapstructure:"variants"`
+}
+
+type GroundingConfig struct {
+	// Action is what happens to answers with invented cars or wrong prices:
+	// "flag", "rewrite" or "regenerate".
+	Action string `mapstructure:"action"`
+}
+
+type GuardConfig struct {
+	// Actions maps a rule name (injection, abuse, spam, moderation) to
+	// refuse, sanitize, escalate or allow. Unlisted rules refuse.
+	Actions    map[string]string `mapstructure:"actions"`
+	MaxLength  int               `mapstructure:"max_length"`
+	Moderation bool              `mapstructure:"moderation"`
+}
+
+type CacheConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// TTL is how long an answer is served; 0 serves it until the knowledge
+	// changes or the cache is invalidated.
+	TTL        time.Duration `mapstructure:"ttl"`
+	Similarity float32       `mapstructure:"similarity"`
+	MaxEntries int           `mapstructure:"max_entries"`
+}
+
+type IntentConfig struct {
+	// LLMFallback asks Model to classify messages the keyword rules can't.
+	LLMFallback bool   `mapstructure:"llm_fallback"`
+	Model       string `mapstructure:"model"`
+}
+
+type StructuredConfig struct {
+	// Enabled asks the model for JSON answers (message, stock IDs, actions)
+	// on non-streaming turns.
+	Enabled bool `mapstructure:"enabled"`
+	// StrictSchema uses the json_schema response format, which needs a model
+	// with structured outputs; otherwise json_object is used.
+	StrictSchema bool `mapstructure:"strict_schema"`
+}
+
+type CritiqueConfig struct {
+	// Intents lists the intents whose answers get a second pass that checks
+	// their numbers before they are sent. Only "financing" has a check.
+	Intents []string `mapstructure:"intents"`
+	// Tolerance is the relative difference allowed between a number in the
+	// answer and the calculated one.
+	Tolerance float64 `mapstructure:"tolerance"`
+}
+
+type MediaConfig struct {
+	// MaxBytes is the largest WhatsApp media file that is downloaded.
+	MaxBytes int64         `mapstructure:"max_bytes"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	// AllowAnyHost lets MediaUrl0 point outside Twilio, for testing with
+	// cmd/mediaserver. Never enable it in production: anyone can post to
+	// /whatsapp and have the bot fetch any URL.
+	AllowAnyHost bool `mapstructure:"allow_any_host"`
+}
+
+type VisionConfig struct {
+	// Enabled describes car photos sent over WhatsApp with Model, which must
+	// accept images, and searches the catalog for similar cars.
+	Enabled bool   `mapstructure:"enabled"`
+	Model   string `mapstructure:"model"`
+}
+
+type SpeechConfig struct {
+	// Enabled transcribes WhatsApp voice notes and answers the transcript.
+	Enabled bool `mapstructure:"enabled"`
+	// Provider is "openai" (Whisper API) or "local", a server with the
+	// whisper.cpp /inference API at URL.
+	Provider string `mapstructure:"provider"`
+	Model    string `mapstructure:"model"`
+	URL      string `mapstructure:"url"`
+	// Language is a hint such as "es"; empty lets the model detect it.
+	Language string `mapstructure:"language"`
+}
+
+type TradeInConfig struct {
+	// Model is the valuation model; "comparables" prices the car from
+	// catalog cars of the same make and model.
+	Model string `mapstructure:"model"`
+	// Depreciation is the yearly loss of value, as a fraction.
+	Depreciation float64 `mapstructure:"depreciation"`
+	// KMAdjustment is the fraction of value lost or gained per 10,000 km of
+	// difference with a comparable.
+	KMAdjustment float64 `mapstructure:"km_adjustment"`
+	// Margin is how far below the retail price the offer is.
+	Margin float64 `mapstructure:"margin"`
+	// Spread is the width of the range around the offer, as a fraction of
+	// the retail price on each side.
+	Spread float64 `mapstructure:"spread"`
+}
+
+type StoreConfig struct {
+	// Backend keeps the sessions in "memory" (lost on restart, one replica
+	// only), in "redis", shared by every replica, or in "sqlite", a file
+	// that survives restarts of a single node.
+	Backend string `mapstructure:"backend"`
+	// MaxHistory caps a session's history at the messages that open its
+	// conversation plus its latest MaxHistory; 0 keeps the whole history.
+	MaxHistory int          `mapstructure:"max_history"`
+	Redis      RedisConfig  `mapstructure:"redis"`
+	SQLite     SQLiteConfig `mapstructure:"sqlite"`
+	Expiry     ExpiryConfig `mapstructure:"expiry"`
+}
+
+type ExpiryConfig struct {
+	// IdleTTL ends a conversation this long after its last message; 0 never
+	// ends it for being idle.
+	IdleTTL time.Duration `mapstructure:"idle_ttl"`
+	// MaxAge ends a conversation this long after it started, however active
+	// it is; 0 means no limit.
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// JanitorInterval is how often expired conversations are removed in the
+	// background; 0 only ends them when their user writes again.
+	JanitorInterval time.Duration `mapstructure:"janitor_interval"`
+	// ReturningTTL is how long the last car of an ended conversation is
+	// kept to welcome its user back; 0 keeps it until the session is
+	// deleted.
+	ReturningTTL time.Duration `mapstructure:"returning_ttl"`
+}
+
+type SQLiteConfig struct {
+	Path string `mapstructure:"path"`
+	// Retention is how long a session is kept after its last message; 0
+	// keeps sessions forever.
+	Retention time.Duration `mapstructure:"retention"`
+	// CompactInterval is how often expired sessions are deleted and the
+	// file is vacuumed; 0 disables compaction.
+	CompactInterval time.Duration `mapstructure:"compact_interval"`
+}
+
+type RedisConfig struct {
+	Addr     string `mapstructure:"addr"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	// Prefix starts every key, so that several deployments can share a
+	// server.
+	Prefix  string        `mapstructure:"prefix"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	// LockTTL frees a session lock whose replica died holding it; it must
+	// be longer than the slowest turn.
+	LockTTL time.Duration `mapstructure:"lock_ttl"`
+}
+
+type ConcurrencyConfig struct {
+	// LockTimeout is how long a message waits for the previous turn of its
+	// session to finish before failing.
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+	// Debounce joins WhatsApp text messages of a session that arrive within
+	// this window into one turn; 0 answers each message on its own.
+	Debounce time.Duration `mapstructure:"debounce"`
+}
+
+type ProfilesConfig struct {
+	// Enabled remembers what customers say they look for (budget, makes,
+	// family size, city...) across their sessions, keyed by their WhatsApp
+	// number or the web's customer_id cookie.
+	Enabled bool `mapstructure:"enabled"`
+}
+
+type ModelPrice struct {
+	Model              string  `mapstructure:"model"`
+	PromptPer1KUSD     float64 `mapstructure:"prompt_per_1k_usd"`
+	CompletionPer1KUSD float64 `mapstructure:"completion_per_1k_usd"`
+	// PerMinuteUSD prices transcription models, which charge by audio
+	// length.
+	PerMinuteUSD float64 `mapstructure:"per_minute_usd"`
+}
+
+type PricingConfig struct {
+	USDToMXN float64      `mapstructure:"usd_to_mxn"`
+	Models   []ModelPrice `mapstructure:"models"`
+}
+
 type Config struct {
-	Server  ServerConfig  `mapstructure:"server"`
-	OpenAI  OpenAIConfig  `mapstructure:"openai"`
-	Catalog CatalogConfig `mapstructure:"catalog"`
-	Twilio  TwilioConfig  `mapstructure:"twilio"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Admin       AdminConfig       `mapstructure:"admin"`
+	OpenAI      OpenAIConfig      `mapstructure:"openai"`
+	Catalog     CatalogConfig     `mapstructure:"catalog"`
+	Twilio      TwilioConfig      `mapstructure:"twilio"`
+	Pricing     PricingConfig     `mapstructure:"pricing"`
+	Kavak       KavakConfig       `mapstructure:"kavak"`
+	Financing   FinancingConfig   `mapstructure:"financing"`
+	Prompts     PromptsConfig     `mapstructure:"prompts"`
+	Experiment  ExperimentConfig  `mapstructure:"experiment"`
+	Grounding   GroundingConfig   `mapstructure:"grounding"`
+	Guard       GuardConfig       `mapstructure:"guard"`
+	Cache       CacheConfig       `mapstructure:"cache"`
+	Intent      IntentConfig      `mapstructure:"intent"`
+	Structured  StructuredConfig  `mapstructure:"structured"`
+	Critique    CritiqueConfig    `mapstructure:"critique"`
+	Media       MediaConfig       `mapstructure:"media"`
+	Vision      VisionConfig      `mapstructure:"vision"`
+	Speech      SpeechConfig      `mapstructure:"speech"`
+	TradeIn     TradeInConfig     `mapstructure:"trade_in"`
+	Store       StoreConfig       `mapstructure:"store"`
+	Concurrency ConcurrencyConfig `mapstructure:"concurrency"`
+	Profiles    ProfilesConfig    `mapstructure:"profiles"`
 }
 
 func Load(path string) (*Config, error) {
@@ -0,0 +1,107 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/compare"
+)
+
+const compareToolName = "compare_cars"
+
+var compareTool = openai.Tool{
+	Type: openai.ToolTypeFunction,
+	Function: &openai.FunctionDefinition{
+		Name:        compareToolName,
+		Description: "Compara lado a lado de 2 a 4 autos del catálogo: precio, kilometraje, año, dimensiones, Bluetooth/CarPlay y pago mensual estimado.",
+		Parameters: rawSchema(`{
+  "type": "object",
+  "properties": {
+    "cars": {
+      "type": "array",
+      "items": {"type": "string"},
+      "description": "stock_id, o marca y modelo (ej. \"Mazda 3\"), de cada auto que pide comparar el usuario; vacía para comparar las últimas recomendaciones"
+    }
+  },
+  "required": ["cars"]
+}`),
+	},
+}
+
+type compareArgs struct {
+	Cars []string `json:"cars"`
+}
+
+// compareCars has the model pick the cars the user wants to compare through
+// the compare_cars tool and adds the tool's result to the history as a
+// system note, so that the answer is written from the comparison.
+func (e *Engine) compareCars(ctx context.Context, sid, model string) {
+	msg, err := e.Client.ChatTools(ctx, model, e.Sessions.GetHistory(sid), []openai.Tool{compareTool}, compareToolName)
+	if err != nil {
+		log.Printf("conversation: session %s: compare tool call failed: %v", sid, err)
+		return
+	}
+	for _, call := range msg.ToolCalls {
+		if call.Function.Name != compareToolName {
+			continue
+		}
+		var args compareArgs
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			log.Printf("conversation: session %s: invalid compare arguments %q: %v", sid, call.Function.Arguments, err)
+		}
+		e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+			Role: "system",
+			Content: "Resultado de compare_cars calculado por el sistema (precios en MXN, dimensiones en mm, tasas y CAT como fracción). " +
+				"Presenta la comparación lado a lado con estos datos, sin inventar otros, y si hay un campo \"error\" explícaselo al usuario:\n" +
+				e.runCompare(sid, args.Cars),
+		})
+		return
+	}
+}
+
+// runCompare is the result of the compare_cars tool: the comparison as JSON
+// or the error the model should explain.
+func (e *Engine) runCompare(sid string, refs []string) string {
+	recent := e.Sessions.GetRecommendations(sid)
+	cars, err := compare.Resolve(e.Catalog, recent, refs)
+	if err != nil {
+		return toolError(err)
+	}
+	if len(cars) < compare.MinCars {
+		cars = appendRecent(cars, recent)
+	}
+	c, err := compare.Compare(cars, e.Financing, e.Sessions.GetFinancingTerms(sid))
+	if err != nil {
+		return toolError(err)
+	}
+	e.Sessions.SetRecommendations(sid, cars)
+	out, _ := json.Marshal(c)
+	return string(out)
+}
+
+// appendRecent completes cars with the recent recommendations, up to the
+// most cars a comparison takes.
+func appendRecent(cars, recent []catalog.Car) []catalog.Car {
+	for _, car := range recent {
+		if len(cars) == compare.MaxCars {
+			break
+		}
+		dup := false
+		for _, c := range cars {
+			dup = dup || c.StockID == car.StockID
+		}
+		if !dup {
+			cars = append(cars, car)
+		}
+	}
+	return cars
+}
+
+func toolError(err error) string {
+	out, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(out)
+}
@@ -0,0 +1,74 @@
+package conversation
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+// batchTimeout bounds a debounced turn, which doesn't end with the request
+// that started it.
+const batchTimeout = 2 * time.Minute
+
+// batch is the messages of a session that will be answered as one turn.
+type batch struct {
+	texts []string
+}
+
+// batchResult is the outcome of a batch's turn.
+type batchResult struct {
+	reply Reply
+	err   error
+}
+
+// RespondDebounced answers text like Respond, but first waits the debounce
+// window, during which later messages of the session join the turn instead
+// of getting one of their own. joined is true for those: their Reply is
+// empty, and the turn's answer goes to the first message. Without a debounce
+// window every message is answered on its own.
+//
+// The messages that joined were already acknowledged, so the turn runs even
+// when the first message's request is canceled: its answer is then only
+// stored in the history.
+func (e *Engine) RespondDebounced(ctx context.Context, sid, endpoint, text string) (reply Reply, joined bool, err error) {
+	window := e.Concurrency.Debounce
+	if window <= 0 {
+		reply, err = e.Respond(ctx, sid, endpoint, text, nil)
+		return reply, false, err
+	}
+
+	e.pendingMu.Lock()
+	if b, ok := e.pending[sid]; ok {
+		b.texts = append(b.texts, text)
+		e.pendingMu.Unlock()
+		return Reply{}, true, nil
+	}
+	b := &batch{texts: []string{text}}
+	e.pending[sid] = b
+	e.pendingMu.Unlock()
+
+	done := make(chan batchResult, 1)
+	go func() {
+		turnCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), batchTimeout)
+		defer cancel()
+		time.Sleep(window)
+		e.pendingMu.Lock()
+		delete(e.pending, sid)
+		texts := b.texts
+		e.pendingMu.Unlock()
+		reply, err := e.Respond(turnCtx, sid, endpoint, strings.Join(texts, "\n"), nil)
+		if err != nil && ctx.Err() != nil {
+			// Nobody is waiting for the answer to report it.
+			log.Printf("conversation: session %s: debounced turn: %v", sid, err)
+		}
+		done <- batchResult{reply, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.reply, false, r.err
+	case <-ctx.Done():
+		return Reply{}, false, ctx.Err()
+	}
+}
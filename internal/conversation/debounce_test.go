@@ -0,0 +1,135 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+)
+
+// waitPending waits until a batch of sid is waiting out the debounce window.
+func waitPending(t *testing.T, e *Engine, sid string) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		e.pendingMu.Lock()
+		_, ok := e.pending[sid]
+		e.pendingMu.Unlock()
+		if ok {
+			return
+		}
+	}
+	t.Fatalf("no batch pending for %s", sid)
+}
+
+func userMessages(e *Engine, sid string) []string {
+	var texts []string
+	for _, m := range e.Sessions.GetHistory(sid) {
+		if m.Role == "user" {
+			texts = append(texts, m.Content)
+		}
+	}
+	return texts
+}
+
+func TestDebounceJoinsBurst(t *testing.T) {
+	e := newTestEngine(t, config.ExpiryConfig{})
+	e.Concurrency.Debounce = 100 * time.Millisecond
+
+	type result struct {
+		reply  Reply
+		joined bool
+		err    error
+	}
+	first := make(chan result)
+	go func() {
+		reply, joined, err := e.RespondDebounced(context.Background(), "s1", "test", "hola")
+		first <- result{reply, joined, err}
+	}()
+	waitPending(t, e, "s1")
+	for _, text := range []string{"quiero hablar", "con un asesor"} {
+		reply, joined, err := e.RespondDebounced(context.Background(), "s1", "test", text)
+		if err != nil || !joined || reply.Text != "" {
+			t.Fatalf("message %q in the window: %+v, joined %v, %v; want it joined", text, reply, joined, err)
+		}
+	}
+	// Another session isn't part of the burst.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, joined, err := e.RespondDebounced(context.Background(), "s2", "test", "un asesor"); joined || err != nil {
+			t.Errorf("other session's message: joined %v, %v", joined, err)
+		}
+	}()
+
+	r := <-first
+	wg.Wait()
+	if r.err != nil || r.joined || r.reply.Text == "" {
+		t.Fatalf("first message: %+v, joined %v, %v; want the turn's answer", r.reply, r.joined, r.err)
+	}
+	got := userMessages(e, "s1")
+	if len(got) != 1 || got[0] != "hola\nquiero hablar\ncon un asesor" {
+		t.Errorf("questions %q, want the burst as one", got)
+	}
+	if got := userMessages(e, "s2"); len(got) != 1 {
+		t.Errorf("other session has questions %q", got)
+	}
+
+	// Once the window closes, the next message starts a new turn.
+	if _, joined, err := e.RespondDebounced(context.Background(), "s1", "test", "un asesor por favor"); joined || err != nil {
+		t.Fatalf("message after the window: joined %v, %v", joined, err)
+	}
+	if got := userMessages(e, "s1"); len(got) != 2 {
+		t.Errorf("questions %q, want two turns", got)
+	}
+}
+
+func TestDebounceDisabled(t *testing.T) {
+	e := newTestEngine(t, config.ExpiryConfig{})
+	for _, text := range []string{"un asesor", "otro asesor"} {
+		if _, joined, err := e.RespondDebounced(context.Background(), "s1", "test", text); joined || err != nil {
+			t.Fatalf("%q: joined %v, %v", text, joined, err)
+		}
+	}
+	if got := userMessages(e, "s1"); len(got) != 2 {
+		t.Errorf("questions %q, want one turn per message", got)
+	}
+}
+
+// TestDebounceCanceled checks that a batch whose first request goes away is
+// still answered: the messages that joined it were already acknowledged.
+func TestDebounceCanceled(t *testing.T) {
+	e := newTestEngine(t, config.ExpiryConfig{})
+	e.Concurrency.Debounce = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, _, err := e.RespondDebounced(ctx, "s1", "test", "hola")
+		done <- err
+	}()
+	waitPending(t, e, "s1")
+	if _, joined, err := e.RespondDebounced(context.Background(), "s1", "test", "quiero un asesor"); !joined || err != nil {
+		t.Fatalf("message in the window: joined %v, %v", joined, err)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled request = %v, want context.Canceled", err)
+	}
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		// The opening, then the question and its answer.
+		if len(e.Sessions.GetHistory("s1")) == 4 {
+			break
+		}
+	}
+	if got := userMessages(e, "s1"); len(got) != 1 || got[0] != "hola\nquiero un asesor" {
+		t.Fatalf("questions %q, want the batch answered as one turn", got)
+	}
+	hist := e.Sessions.GetHistory("s1")
+	if last := hist[len(hist)-1]; last.Role != "assistant" || last.Content == "" {
+		t.Errorf("batch not answered: last message %+v", last)
+	}
+}
@@ -0,0 +1,326 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/cache"
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/critique"
+	"carlospayan/agent-comercial-ai/internal/customer"
+	"carlospayan/agent-comercial-ai/internal/experiments"
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/grounding"
+	"carlospayan/agent-comercial-ai/internal/guard"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+	"carlospayan/agent-comercial-ai/internal/intent"
+	"carlospayan/agent-comercial-ai/internal/llm"
+	"carlospayan/agent-comercial-ai/internal/media"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+	"carlospayan/agent-comercial-ai/internal/prompts"
+	"carlospayan/agent-comercial-ai/internal/speech"
+	"carlospayan/agent-comercial-ai/internal/store"
+	"carlospayan/agent-comercial-ai/internal/tradein"
+	"carlospayan/agent-comercial-ai/internal/usage"
+	"carlospayan/agent-comercial-ai/internal/vision"
+)
+
+// Deps are the services a conversation is built from.
+type Deps struct {
+	Client   *llm.Client
+	Sessions store.SessionStore
+	// Expiry ends conversations that have been idle or open for too long.
+	Expiry     config.ExpiryConfig
+	KavakInfo  string
+	Catalog    *catalog.Catalog
+	Prompts    *prompts.Library
+	Experiment *experiments.Experiment
+	Grounding  *grounding.Checker
+	Critique   *critique.Checker
+	Financing  *financing.Calculator
+	// TradeIn values the customers' cars and TradeInParser reads their
+	// data from messages.
+	TradeIn       tradein.Valuer
+	TradeInParser *tradein.Parser
+	Media         *media.Fetcher
+	Vision        *vision.Describer
+	Speech        speech.Transcriber
+	Guard         *guard.Guard
+	Cache         *cache.Cache
+	Intents       *intent.Classifier
+	Structured    config.StructuredConfig
+	Concurrency   config.ConcurrencyConfig
+	// Profiles remembers customers' preferences across sessions;
+	// Preferences reads them from messages.
+	Profiles    config.ProfilesConfig
+	Preferences *customer.Extractor
+}
+
+// Engine runs one conversational turn for every channel (web, streaming and
+// WhatsApp): guard, intent, cache, retrieval, LLM and grounding.
+type Engine struct {
+	Deps
+	// pending holds the messages of each session waiting out the debounce
+	// window.
+	pendingMu sync.Mutex
+	pending   map[string]*batch
+	// infoMu guards KavakInfo, which RefreshKavakInfo updates.
+	infoMu sync.RWMutex
+}
+
+func New(d Deps) *Engine {
+	e := &Engine{Deps: d, pending: make(map[string]*batch)}
+	e.setKavakInfo(d.KavakInfo)
+	return e
+}
+
+// Reply is the outcome of one turn.
+type Reply struct {
+	Text   string
+	Intent intent.Intent
+	// Lang is the conversation language the turn was answered in.
+	Lang i18n.Lang
+	// Cars are the catalog results sent to the model this turn, if a search
+	// ran.
+	Cars []catalog.Car
+	// StockIDs and Actions come from structured answers: the catalog cars
+	// the answer talks about and the follow-ups it suggests.
+	StockIDs []string
+	Actions  []string
+	// Quote is set when Text is a financing plan for a known car, so that
+	// channels can link to the full quote.
+	Quote *QuoteRequest
+	// Streamed is true when Text was already delivered through onDelta.
+	Streamed bool
+}
+
+// QuoteRequest identifies a financing plan: a catalog car, a down payment,
+// a term in years (0 for the default term) and the credit profile.
+type QuoteRequest struct {
+	StockID     string
+	DownPayment float64
+	Years       int
+	Profile     financing.Profile
+}
+
+// Respond answers text for session sid. endpoint labels metrics and usage.
+// When onDelta is not nil the LLM answer is streamed through it; canned and
+// cached answers are not, so callers must check Reply.Streamed.
+func (e *Engine) Respond(ctx context.Context, sid, endpoint, text string, onDelta func(string) error) (Reply, error) {
+	unlock, err := e.lock(ctx, sid)
+	if err != nil {
+		return Reply{}, err
+	}
+	defer unlock()
+	return e.respond(ctx, sid, endpoint, message{text: text}, onDelta)
+}
+
+// lock waits for the running turn of sid, if any, to finish, so that the
+// turns of a session don't interleave their reads and writes of its history.
+func (e *Engine) lock(ctx context.Context, sid string) (func(), error) {
+	if e.Concurrency.LockTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Concurrency.LockTimeout)
+		defer cancel()
+	}
+	unlock, err := e.Sessions.Lock(ctx, sid)
+	if err != nil {
+		return nil, fmt.Errorf("error waiting for the previous message of the session: %w", err)
+	}
+	return unlock, nil
+}
+
+// message is a user turn.
+type message struct {
+	text string
+	// intent skips classification when the intent is known, like for the
+	// description of a photo.
+	intent intent.Intent
+	// tag marks where the text came from in the history, e.g. the tag of
+	// transcribed voice notes. The text itself is what gets processed.
+	tag string
+	// started is set when the caller already started the session for this
+	// turn, e.g. to word the text in the session language, so that it isn't
+	// started twice.
+	started *session
+}
+
+// session is what startSession returns: the variant and language of the
+// turn.
+type session struct {
+	variant experiments.Variant
+	lang    i18n.Lang
+}
+
+// stored is the message as it's kept in the history.
+func (m message) stored(text string) string {
+	if m.tag == "" {
+		return text
+	}
+	return m.tag + " " + text
+}
+
+// respond runs the turn of msg. The caller holds the session's lock.
+func (e *Engine) respond(ctx context.Context, sid, endpoint string, msg message, onDelta func(string) error) (Reply, error) {
+	ctx = usage.WithScope(ctx, sid, endpoint, e.Sessions)
+	text, in := msg.text, msg.intent
+	var variant experiments.Variant
+	var lang i18n.Lang
+	if msg.started != nil {
+		variant, lang = msg.started.variant, msg.started.lang
+	} else {
+		variant, lang = e.startSession(ctx, sid, text)
+	}
+
+	verdict := e.Guard.Inspect(ctx, sid, text)
+	if verdict.Blocked() {
+		key := i18n.Refuse
+		if verdict.Decision == guard.Escalate {
+			key = i18n.Escalate
+		}
+		return Reply{Text: i18n.Message(lang, key), Lang: lang}, nil
+	}
+	text = verdict.Text
+
+	if answer, ok := e.profileCommand(ctx, sid, lang, text); ok {
+		return Reply{Text: answer, Lang: lang}, nil
+	}
+
+	if in == "" && e.continuesTradeIn(sid, text) {
+		in = intent.TradeIn
+	}
+	if in == "" {
+		in = e.Intents.Classify(ctx, text)
+	}
+	e.updateProfile(ctx, text, in)
+	reply := Reply{Intent: in, Lang: lang}
+
+	switch in {
+	case intent.Handoff:
+		log.Printf("conversation: session %s asked for an advisor", sid)
+		reply.Text = i18n.Message(lang, i18n.Handoff)
+		e.storeTurn(sid, msg.stored(text), reply.Text)
+		e.countTurn(sid, endpoint, variant, in)
+		return reply, nil
+	case intent.OutOfScope:
+		reply.Text = i18n.Message(lang, i18n.OutOfScope)
+		e.storeTurn(sid, msg.stored(text), reply.Text)
+		e.countTurn(sid, endpoint, variant, in)
+		return reply, nil
+	}
+
+	// A car picked from the last recommendations stays the last car even
+	// when the message also asks for a search; picking one by position only
+	// makes sense for the list shown, so it doesn't search again.
+	ref := e.resolveReference(sid, lang, text)
+	search := in.NeedsSearch() && ref != byPosition
+
+	var qEmb []float32
+	scope, cacheable := e.cacheScope(sid, variant, lang, in)
+	if cacheable || search {
+		catStart := time.Now()
+		var err error
+		qEmb, err = e.Catalog.Embed(ctx, text)
+		if err != nil {
+			return reply, fmt.Errorf("error searching in catalog: %w", err)
+		}
+		if cacheable {
+			if answer, ok := e.Cache.Get(scope, qEmb); ok {
+				reply.Text = answer
+				e.storeTurn(sid, msg.stored(text), answer)
+				e.countTurn(sid, endpoint, variant, in)
+				return reply, nil
+			}
+		}
+		if search {
+			var budget *budgetSearch
+			if in == intent.Affordability {
+				budget = e.budget(sid, text)
+			}
+			if budget != nil {
+				reply.Cars = e.Catalog.SearchFiltered(qEmb, variant.TopN, budget.filter)
+			} else {
+				reply.Cars = e.Catalog.SearchEmbedding(qEmb, variant.TopN)
+			}
+			metrics.CatLatency.Observe(float64(time.Since(catStart).Milliseconds()))
+			e.Sessions.SetRecommendations(sid, reply.Cars)
+			if len(reply.Cars) > 0 && ref == noReference {
+				e.Sessions.SetLastCar(sid, reply.Cars[0])
+			}
+			e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+				Role:    "assistant",
+				Content: recommendationsBlock(lang, fmt.Sprintf(i18n.Message(lang, i18n.RecommendationsHeader), len(reply.Cars)), reply.Cars, e.Structured.Enabled),
+			})
+			if budget != nil {
+				e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+					Role:    "system",
+					Content: e.budgetNote(budget, reply.Cars),
+				})
+			}
+		}
+	}
+
+	e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+		Role:    "user",
+		Content: msg.stored(text),
+	})
+	var simulated *QuoteRequest
+	switch in {
+	case intent.Financing:
+		simulated = e.simulate(sid, text)
+	case intent.Compare:
+		e.compareCars(ctx, sid, variant.Model)
+	case intent.TradeIn:
+		e.tradeIn(sid, text)
+	}
+
+	llmStart := time.Now()
+	var history []openai.ChatCompletionMessage
+	if cacheable {
+		history = e.cacheablePrompt(sid, lang, text)
+	} else {
+		history = e.withLastCar(sid, lang, e.Sessions.GetHistory(sid))
+	}
+	var answer string
+	var err error
+	switch {
+	case onDelta != nil:
+		answer, err = e.Client.ChatStream(ctx, variant.Model, history, onDelta)
+		reply.Streamed = true
+	case e.Structured.Enabled:
+		var out Structured
+		out, err = e.chatStructured(ctx, variant.Model, history)
+		answer, reply.StockIDs, reply.Actions = out.Message, out.StockIDs, out.Actions
+	default:
+		answer, err = e.Client.Chat(ctx, variant.Model, history)
+	}
+	metrics.LLMLatency.Observe(float64(time.Since(llmStart).Milliseconds()))
+	if err != nil {
+		return reply, fmt.Errorf("error calling LLM: %w", err)
+	}
+	e.recordStockIDs(sid, reply.StockIDs)
+	reply.Text = e.ground(ctx, sid, variant.Model, history, answer)
+	reply.Text = e.critique(ctx, sid, in, lang, variant.Model, history, reply.Text)
+	if in == intent.Financing {
+		reply.Quote = simulated
+		if reply.Quote == nil {
+			reply.Quote = e.quoteRequest(sid, reply.Text)
+		}
+	}
+
+	e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+		Role:    "assistant",
+		Content: reply.Text,
+	})
+	e.countTurn(sid, endpoint, variant, in)
+	if cacheable {
+		e.Cache.Put(scope, qEmb, reply.Text)
+	}
+	return reply, nil
+}
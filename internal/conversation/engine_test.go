@@ -0,0 +1,105 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+	"carlospayan/agent-comercial-ai/internal/store"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// slowStore makes appends slow enough for turns that don't wait for each
+// other to interleave.
+type slowStore struct {
+	store.SessionStore
+}
+
+func (s slowStore) AppendMessage(sid string, msg openai.ChatCompletionMessage) {
+	time.Sleep(time.Millisecond)
+	s.SessionStore.AppendMessage(sid, msg)
+}
+
+// TestConcurrentTurns fires turns of one session at once: the session
+// starts once and every turn's question and answer stay together.
+func TestConcurrentTurns(t *testing.T) {
+	e := newTestEngine(t, config.ExpiryConfig{})
+	e.Sessions = slowStore{e.Sessions}
+	const turns = 20
+	var wg sync.WaitGroup
+	for i := 0; i < turns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := e.Respond(context.Background(), "s1", "test", fmt.Sprintf("quiero hablar con un asesor %d", i), nil); err != nil {
+				t.Errorf("turn %d: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	hist := e.Sessions.GetHistory("s1")
+	if len(hist) != 2+2*turns {
+		t.Fatalf("history has %d messages, want the opening and %d turns", len(hist), turns)
+	}
+	if hist[0].Role != "system" || !strings.Contains(hist[1].Content, "Kavak info") {
+		t.Fatalf("history doesn't open with the system prompt and Kavak info")
+	}
+	answer := i18n.Message(i18n.Spanish, i18n.Handoff)
+	seen := make(map[string]bool)
+	for i := 2; i < len(hist); i += 2 {
+		q, a := hist[i], hist[i+1]
+		if q.Role != "user" || !strings.HasPrefix(q.Content, "quiero hablar con un asesor") || seen[q.Content] {
+			t.Fatalf("message %d is %s %q, want a new question", i, q.Role, q.Content)
+		}
+		seen[q.Content] = true
+		if a.Role != "assistant" || a.Content != answer {
+			t.Fatalf("message %d is %s %q, want the answer to %q", i+1, a.Role, a.Content, q.Content)
+		}
+	}
+}
+
+// TestTurnsInOrder checks that the turns a customer sends one after another
+// are stored in that order.
+func TestTurnsInOrder(t *testing.T) {
+	e := newTestEngine(t, config.ExpiryConfig{})
+	for i := 0; i < 5; i++ {
+		if _, err := e.Respond(context.Background(), "s1", "test", fmt.Sprintf("quiero un asesor %d", i), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, m := range e.Sessions.GetHistory("s1") {
+		if m.Role == "user" {
+			got = append(got, m.Content)
+		}
+	}
+	for i, q := range got {
+		if want := fmt.Sprintf("quiero un asesor %d", i); q != want {
+			t.Errorf("question %d is %q, want %q", i, q, want)
+		}
+	}
+}
+
+func TestRespondWaitsForRunningTurn(t *testing.T) {
+	e := newTestEngine(t, config.ExpiryConfig{})
+	e.Concurrency.LockTimeout = 50 * time.Millisecond
+	unlock, err := e.Sessions.Lock(context.Background(), "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	if _, err := e.Respond(context.Background(), "s1", "test", "quiero un asesor", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Respond while a turn runs = %v, want the lock timeout", err)
+	}
+	if hist := e.Sessions.GetHistory("s1"); len(hist) != 0 {
+		t.Errorf("turn that timed out stored %d messages", len(hist))
+	}
+}
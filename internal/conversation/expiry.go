@@ -0,0 +1,108 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+	"carlospayan/agent-comercial-ai/internal/store"
+)
+
+// expired reports whether a conversation with activity a has ended at now,
+// for being idle longer than the idle TTL or older than the max age.
+func (e *Engine) expired(a store.Activity, now time.Time) bool {
+	idle := e.Expiry.IdleTTL > 0 && now.Sub(a.LastMessage) > e.Expiry.IdleTTL
+	old := e.Expiry.MaxAge > 0 && !a.Started.IsZero() && now.Sub(a.Started) > e.Expiry.MaxAge
+	return idle || old
+}
+
+// resetSession ends the conversation of sid, remembering for the returning
+// TTL the stock ID of the car the user last looked at, for the welcome back.
+func (e *Engine) resetSession(sid, source string) {
+	if car, ok := e.currentCar(sid); ok {
+		e.Sessions.SetLastCar(sid, catalog.Car{StockID: car.StockID})
+	}
+	e.Sessions.ResetSession(sid, e.Expiry.ReturningTTL)
+	metrics.SessionsExpired.WithLabelValues(source).Inc()
+}
+
+// welcomeBack adds the system note that has the model greet a returning
+// user, with the car they last looked at when it's still in the catalog,
+// which becomes the last car of the new conversation.
+func (e *Engine) welcomeBack(sid string, lang i18n.Lang) {
+	note := i18n.Message(lang, i18n.WelcomeBack)
+	if ref, ok := e.Sessions.GetLastCar(sid); ok {
+		if car, ok := e.Catalog.ByStockID(ref.StockID); ok {
+			e.Sessions.SetLastCar(sid, car)
+			note += " " + fmt.Sprintf(i18n.Message(lang, i18n.WelcomeBackCar), car.Make, car.Model, car.Version, car.Year)
+		}
+	}
+	e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+		Role:    "system",
+		Content: note,
+	})
+}
+
+// RunJanitor ends expired conversations and forgets the ended ones kept
+// past the returning TTL every janitor interval until ctx is done, so that
+// the sessions of users who don't come back don't pile up.
+func (e *Engine) RunJanitor(ctx context.Context) {
+	if e.Expiry.JanitorInterval <= 0 || e.Expiry.IdleTTL <= 0 && e.Expiry.MaxAge <= 0 && e.Expiry.ReturningTTL <= 0 {
+		return
+	}
+	t := time.NewTicker(e.Expiry.JanitorInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			if n := e.expireSessions(now); n > 0 {
+				log.Printf("conversation: janitor ended %d expired sessions", n)
+			}
+			if n := e.Sessions.Forget(now); n > 0 {
+				log.Printf("conversation: janitor forgot %d ended sessions", n)
+			}
+		}
+	}
+}
+
+func (e *Engine) expireSessions(now time.Time) int {
+	var idleBefore, startedBefore time.Time
+	if e.Expiry.IdleTTL > 0 {
+		idleBefore = now.Add(-e.Expiry.IdleTTL)
+	}
+	if e.Expiry.MaxAge > 0 {
+		startedBefore = now.Add(-e.Expiry.MaxAge)
+	}
+	n := 0
+	for _, sid := range e.Sessions.Expired(idleBefore, startedBefore) {
+		if e.expireSession(sid, now) {
+			n++
+		}
+	}
+	return n
+}
+
+// expireSession ends the conversation of sid if it's still expired once no
+// turn of it is running: its user may have written in the meantime.
+func (e *Engine) expireSession(sid string, now time.Time) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	unlock, err := e.Sessions.Lock(ctx, sid)
+	if err != nil {
+		return false
+	}
+	defer unlock()
+	if a, ok := e.Sessions.Activity(sid); !ok || !e.expired(a, now) {
+		return false
+	}
+	e.resetSession(sid, "janitor")
+	return true
+}
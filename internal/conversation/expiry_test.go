@@ -0,0 +1,150 @@
+package conversation
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/experiments"
+	"carlospayan/agent-comercial-ai/internal/guard"
+	"carlospayan/agent-comercial-ai/internal/intent"
+	"carlospayan/agent-comercial-ai/internal/prompts"
+	"carlospayan/agent-comercial-ai/internal/store"
+)
+
+var testCars = []catalog.Car{
+	{StockID: "243587", Make: "Mazda", Model: "CX-5", Version: "Grand Touring", Year: 2019, Price: 396999, KM: 42000, Embedding: []float32{1, 0}},
+	{StockID: "229472", Make: "Toyota", Model: "RAV4", Version: "Limited AWD", Year: 2018, Price: 375999, KM: 98570, Embedding: []float32{0, 1}},
+}
+
+// newTestEngine returns an engine over an in-memory store and testCars,
+// without an LLM client: intents come from the rules, so only turns the
+// rules answer, like asking for an advisor, can run.
+func newTestEngine(t *testing.T, expiry config.ExpiryConfig) *Engine {
+	t.Helper()
+	lib, err := prompts.Load(config.PromptsConfig{Dir: "../../prompts", Version: "v1"}, prompts.Data{
+		Financing: config.FinancingConfig{AnnualRate: 0.169, MinYears: 3, MaxYears: 6, DefaultYears: 5},
+	})
+	if err != nil {
+		t.Fatalf("loading prompts: %v", err)
+	}
+	return New(Deps{
+		Sessions:   store.NewMemory(0),
+		Expiry:     expiry,
+		KavakInfo:  "Kavak info",
+		Catalog:    catalog.New(nil, testCars),
+		Prompts:    lib,
+		Experiment: experiments.New(config.ExperimentConfig{}, experiments.Variant{PromptVersion: "v1"}),
+		Guard:      guard.New(config.GuardConfig{}),
+		Intents:    intent.NewClassifier(config.IntentConfig{}, nil),
+	})
+}
+
+func TestJanitor(t *testing.T) {
+	e := newTestEngine(t, config.ExpiryConfig{IdleTTL: time.Hour, ReturningTTL: 24 * time.Hour})
+	for _, sid := range []string{"idle", "other"} {
+		e.startSession(context.Background(), sid, "hola")
+	}
+	e.Sessions.SetLastCar("idle", testCars[0])
+
+	now := time.Now()
+	if n := e.expireSessions(now); n != 0 {
+		t.Fatalf("ended %d active conversations", n)
+	}
+	later := now.Add(2 * time.Hour)
+	if n := e.expireSessions(later); n != 2 {
+		t.Fatalf("ended %d idle conversations, want 2", n)
+	}
+	if hist := e.Sessions.GetHistory("idle"); len(hist) != 0 {
+		t.Errorf("expired conversation kept %d messages", len(hist))
+	}
+	ref, ok := e.Sessions.GetLastCar("idle")
+	if !ok {
+		t.Fatalf("expired conversation forgot its last car")
+	}
+	if ref.StockID != testCars[0].StockID || ref.Make != "" || ref.Embedding != nil {
+		t.Errorf("kept %+v, want only the stock ID", ref)
+	}
+	if n := e.expireSessions(later); n != 0 {
+		t.Errorf("ended %d conversations that had ended already", n)
+	}
+
+	if n := e.Sessions.Forget(now.Add(12 * time.Hour)); n != 0 {
+		t.Errorf("forgot %d sessions before the returning TTL", n)
+	}
+	if n := e.Sessions.Forget(now.Add(25 * time.Hour)); n != 2 {
+		t.Errorf("forgot %d sessions after the returning TTL, want 2", n)
+	}
+	if _, ok := e.Sessions.Activity("idle"); ok {
+		t.Errorf("forgotten session still has activity")
+	}
+}
+
+func TestJanitorSkipsTurnInProgress(t *testing.T) {
+	e := newTestEngine(t, config.ExpiryConfig{IdleTTL: time.Hour})
+	e.startSession(context.Background(), "s1", "hola")
+	unlock, err := e.Sessions.Lock(context.Background(), "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	if e.expireSession("s1", time.Now().Add(2*time.Hour)) {
+		t.Errorf("ended a conversation while one of its turns was running")
+	}
+	if hist := e.Sessions.GetHistory("s1"); len(hist) == 0 {
+		t.Errorf("conversation lost its history")
+	}
+}
+
+func TestWelcomeBack(t *testing.T) {
+	e := newTestEngine(t, config.ExpiryConfig{IdleTTL: time.Hour})
+	e.startSession(context.Background(), "s1", "hola")
+	e.Sessions.SetRecommendations("s1", testCars)
+	e.Sessions.SetLastCar("s1", testCars[1])
+	e.resetSession("s1", "janitor")
+
+	e.startSession(context.Background(), "s1", "hola otra vez")
+	hist := e.Sessions.GetHistory("s1")
+	if len(hist) != 3 {
+		t.Fatalf("new conversation has %d messages, want the system prompt, Kavak info and welcome back", len(hist))
+	}
+	note := hist[2]
+	if note.Role != "system" || !strings.Contains(note.Content, "¡Hola de nuevo!") {
+		t.Errorf("welcome back note %q", note.Content)
+	}
+	if !strings.Contains(note.Content, "Toyota RAV4 Limited AWD (2018)") {
+		t.Errorf("welcome back doesn't mention the last car: %q", note.Content)
+	}
+	if car, _ := e.Sessions.GetLastCar("s1"); car.Make != "Toyota" {
+		t.Errorf("last car of the new conversation %+v, want the RAV4 from the catalog", car)
+	}
+}
+
+func TestWelcomeBackCarSold(t *testing.T) {
+	e := newTestEngine(t, config.ExpiryConfig{IdleTTL: time.Hour})
+	e.startSession(context.Background(), "s1", "hola")
+	e.Sessions.SetLastCar("s1", catalog.Car{StockID: "sold", Make: "Seat", Model: "Ibiza"})
+	e.resetSession("s1", "janitor")
+
+	e.startSession(context.Background(), "s1", "hola")
+	note := e.Sessions.GetHistory("s1")[2].Content
+	if !strings.Contains(note, "¡Hola de nuevo!") || strings.Contains(note, "Seat") {
+		t.Errorf("welcome back note %q, want no car", note)
+	}
+	if car, ok := e.currentCar("s1"); ok {
+		t.Errorf("current car %+v, want none", car)
+	}
+}
+
+func TestNewUserNotWelcomedBack(t *testing.T) {
+	e := newTestEngine(t, config.ExpiryConfig{IdleTTL: time.Hour})
+	e.startSession(context.Background(), "s1", "hola")
+	for _, m := range e.Sessions.GetHistory("s1") {
+		if strings.Contains(m.Content, "¡Hola de nuevo!") {
+			t.Errorf("new user welcomed back")
+		}
+	}
+}
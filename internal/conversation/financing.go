@@ -0,0 +1,142 @@
+package conversation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/critique"
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+)
+
+// simulate updates the session's financing terms with the ones in text and,
+// when the car and down payment are known, adds the plan calculated in Go to
+// the history as a system note, so that the model presents it instead of
+// doing the math. It returns the plan's quote, or nil when there's no plan.
+func (e *Engine) simulate(sid, text string) *QuoteRequest {
+	terms := e.Sessions.GetFinancingTerms(sid).Merge(financing.ParseTerms(text))
+	e.Sessions.SetFinancingTerms(sid, terms)
+
+	car, ok := e.currentCar(sid)
+	if e.Financing == nil || !ok || terms.TotalDownPayment() == 0 {
+		return nil
+	}
+	plan, err := e.Financing.SimulateProfile(terms.Profile, car.Price, terms.TotalDownPayment(), terms.Years)
+	if err != nil {
+		e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+			Role:    "system",
+			Content: e.termsProblem(car.Price, terms, err),
+		})
+		return nil
+	}
+
+	profile := "no declarado; menciona que la tasa puede mejorar según su historial crediticio"
+	if terms.Profile != financing.Unknown {
+		profile = profileNames[terms.Profile]
+	}
+	note := fmt.Sprintf("Simulación de financiamiento calculada por el sistema para %s %s %s (%d), stock_id %s. "+
+		"Preséntala usando exactamente estos valores, sin recalcularlos:\n%s\n- Perfil de crédito: %s",
+		car.Make, car.Model, car.Version, car.Year, car.StockID, critique.PlanLines(plan), profile)
+	if terms.TradeIn > 0 {
+		note += fmt.Sprintf("\nEl enganche incluye %s MXN de la oferta estimada por su auto a cuenta y %s MXN en efectivo; menciónalo.",
+			i18n.NoteAmount(terms.TradeIn), i18n.NoteAmount(terms.DownPayment))
+	}
+	e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+		Role:    "system",
+		Content: note,
+	})
+	return &QuoteRequest{StockID: car.StockID, DownPayment: terms.TotalDownPayment(), Years: terms.Years, Profile: terms.Profile}
+}
+
+var profileNames = map[financing.Profile]string{
+	financing.Excellent: "excelente",
+	financing.Good:      "bueno",
+	financing.Fair:      "regular",
+	financing.Limited:   "limitado",
+}
+
+// budgetSearch is a search for the cars a monthly budget can pay for.
+type budgetSearch struct {
+	terms    financing.Terms
+	maxPrice float64
+	filter   catalog.Filter
+}
+
+// budget updates the session's financing terms with the ones in text and
+// returns the search for the cars they can pay for, combined with the
+// filters text asks for. It returns nil when there's no monthly budget yet.
+func (e *Engine) budget(sid, text string) *budgetSearch {
+	terms := e.Sessions.GetFinancingTerms(sid).Merge(financing.ParseTerms(text))
+	e.Sessions.SetFinancingTerms(sid, terms)
+	if e.Financing == nil || terms.MonthlyBudget == 0 {
+		return nil
+	}
+	maxPrice, err := e.Financing.MaxPrice(terms.Profile, terms.MonthlyBudget, terms.TotalDownPayment(), terms.Years)
+	if err != nil {
+		e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+			Role:    "system",
+			Content: e.termsProblem(0, terms, err),
+		})
+		return nil
+	}
+	filter := e.Catalog.ParseFilter(text)
+	filter.MaxPrice = maxPrice
+	return &budgetSearch{terms: terms, maxPrice: maxPrice, filter: filter}
+}
+
+// budgetNote tells the model the price limit of a budget search and the
+// monthly payment of each car found.
+func (e *Engine) budgetNote(b *budgetSearch, cars []catalog.Car) string {
+	years := b.terms.Years
+	if years == 0 {
+		years = e.Financing.Config().DefaultYears
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Búsqueda por mensualidad calculada por el sistema: con %s MXN al mes (incluido el seguro), %s MXN de enganche y %d años de plazo, "+
+		"el precio máximo es %s MXN.", i18n.NoteAmount(b.terms.MonthlyBudget), i18n.NoteAmount(b.terms.TotalDownPayment()), years, i18n.NoteAmount(b.maxPrice))
+	if b.terms.TotalDownPayment() == 0 {
+		sb.WriteString(" El usuario no indicó enganche; menciona que con enganche el precio máximo sube.")
+	}
+	if len(cars) == 0 {
+		sb.WriteString("\nNo hay autos en el catálogo que cumplan esas condiciones. Dilo con amabilidad y sugiere aumentar el enganche o el plazo.")
+		return sb.String()
+	}
+	sb.WriteString("\nPresenta las recomendaciones con su pago mensual usando exactamente estos valores:")
+	for _, car := range cars {
+		fmt.Fprintf(&sb, "\n- %s %s %s (%d): ", car.Make, car.Model, car.Version, car.Year)
+		plan, err := e.Financing.SimulateProfile(b.terms.Profile, car.Price, b.terms.TotalDownPayment(), b.terms.Years)
+		if err != nil {
+			fmt.Fprintf(&sb, "precio %s MXN, se puede pagar de contado con el enganche", i18n.NoteAmount(car.Price))
+			continue
+		}
+		fmt.Fprintf(&sb, "pago mensual %s MXN (%s MXN más %s MXN de seguro), tasa anual %s%%, CAT %s%% sin IVA",
+			i18n.NoteAmount(plan.MonthlyTotal()), i18n.NoteAmount(plan.MonthlyPayment), i18n.NoteAmount(plan.MonthlyInsurance),
+			i18n.FormatNumber(i18n.Spanish, plan.AnnualRate*100, 2), i18n.FormatNumber(i18n.Spanish, plan.CAT*100, 2))
+	}
+	return sb.String()
+}
+
+// termsProblem is the note telling the model why the user's terms can't be
+// simulated.
+func (e *Engine) termsProblem(price float64, terms financing.Terms, err error) string {
+	cfg := e.Financing.Config()
+	switch {
+	case errors.Is(err, financing.ErrDownPaymentTooHigh):
+		return fmt.Sprintf("El enganche que indicó el usuario (%s MXN) es igual o mayor al precio del auto (%s MXN). "+
+			"Explícalo con amabilidad y pregúntale si prefiere pagar de contado o un enganche menor.", i18n.NoteAmount(terms.TotalDownPayment()), i18n.NoteAmount(price))
+	case errors.Is(err, financing.ErrDownPaymentTooLow):
+		return fmt.Sprintf("El enganche que indicó el usuario (%s MXN) es menor al mínimo de %s MXN. "+
+			"Explícalo con amabilidad y pregúntale si puede dar al menos ese enganche.", i18n.NoteAmount(terms.TotalDownPayment()), i18n.NoteAmount(price*cfg.MinDownPayment))
+	case errors.Is(err, financing.ErrInvalidBudget):
+		return "El presupuesto mensual que indicó el usuario no es válido. Pregúntale cuánto puede pagar al mes."
+	case errors.Is(err, financing.ErrTermOutOfRange):
+		return fmt.Sprintf("El plazo que pidió el usuario (%d años) está fuera del rango permitido de %d a %d años. "+
+			"Explícalo con amabilidad y pregúntale qué plazo dentro del rango prefiere.", terms.Years, cfg.MinYears, cfg.MaxYears)
+	default:
+		return "No fue posible simular el financiamiento con los datos del usuario. Pídele que confirme el enganche y el plazo."
+	}
+}
@@ -0,0 +1,73 @@
+package conversation
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/i18n"
+)
+
+// kavakInfo returns the Kavak info new conversations start with.
+func (e *Engine) kavakInfo() string {
+	e.infoMu.RLock()
+	defer e.infoMu.RUnlock()
+	return e.KavakInfo
+}
+
+// setKavakInfo makes info the Kavak info of new conversations and drops the
+// cached answers when it changed.
+func (e *Engine) setKavakInfo(info string) {
+	e.infoMu.Lock()
+	e.KavakInfo = info
+	e.infoMu.Unlock()
+	if e.Cache != nil {
+		e.Cache.SetKnowledge(fmt.Sprintf("%x", sha256.Sum256([]byte(info+strings.Join(e.Prompts.Versions(), ",")))))
+	}
+}
+
+// RefreshKavakInfo fetches the Kavak info every interval until ctx is done,
+// so that conversations and cached answers follow changes to it. A failed
+// fetch keeps the info there was.
+func (e *Engine) RefreshKavakInfo(ctx context.Context, interval time.Duration, fetch func() (string, error)) {
+	if interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			info, err := fetch()
+			if err != nil {
+				log.Printf("conversation: refreshing Kavak info: %v", err)
+				continue
+			}
+			if info != e.kavakInfo() {
+				log.Printf("conversation: Kavak info changed, dropping cached answers")
+				e.setKavakInfo(info)
+			}
+		}
+	}
+}
+
+// cacheablePrompt is what a cacheable answer is generated from: the system
+// prompt and Kavak info every conversation starts with, and the question.
+// Nothing of the session goes in (profile, welcome back, last car...), so
+// that the answer can be served to any session of the cache scope.
+func (e *Engine) cacheablePrompt(sid string, lang i18n.Lang, question string) []openai.ChatCompletionMessage {
+	version, _ := e.Sessions.GetPromptVersion(sid)
+	_, system := e.Prompts.System(version, lang)
+	return []openai.ChatCompletionMessage{
+		{Role: "system", Content: system},
+		{Role: "assistant", Content: i18n.Message(lang, i18n.KavakInfoHeader) + "\n" + e.kavakInfo()},
+		{Role: "user", Content: question},
+	}
+}
@@ -0,0 +1,180 @@
+package conversation
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+)
+
+const (
+	ordinalWords  = `(primer[oa]?|segund[oa]|tercer[oa]?|cuart[oa]|ultim[oa]|first|second|third|fourth|last|primeir[oa]|terceir[oa]|quart[oa])\b`
+	ordinalNumber = `\b(?:opcion|option|opcao|numero|number)\s*#?\s*([1-4])\b`
+)
+
+var (
+	// ordinalRe finds references to a recommendation by its position, like
+	// "el segundo", "the third one" or "la opción 2". ordinalPtRe also takes
+	// the Portuguese articles ("o segundo"), which in Spanish are ordinary
+	// words ("a segunda vista", "o último").
+	ordinalRe   = regexp.MustCompile(`\b(?:el|la|the)\s+` + ordinalWords + `|` + ordinalNumber)
+	ordinalPtRe = regexp.MustCompile(`\b(?:el|la|the|o|a)\s+` + ordinalWords + `|` + ordinalNumber)
+	ordinals    = map[string]int{
+		"primer": 1, "primero": 1, "primera": 1, "first": 1, "primeiro": 1, "primeira": 1, "1": 1,
+		"segundo": 2, "segunda": 2, "second": 2, "2": 2,
+		"tercer": 3, "tercero": 3, "tercera": 3, "third": 3, "terceiro": 3, "terceira": 3, "3": 3,
+		"cuarto": 4, "cuarta": 4, "fourth": 4, "quarto": 4, "quarta": 4, "4": 4,
+		"ultimo": -1, "ultima": -1, "last": -1,
+	}
+	refAccents = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ñ", "n", "ã", "a", "õ", "o", "ç", "c", "ê", "e", "ô", "o")
+)
+
+// currentCar is the car the conversation is about: the last car the session
+// chose, with its current catalog data, or else the first of the last
+// recommendations.
+func (e *Engine) currentCar(sid string) (catalog.Car, bool) {
+	if car, ok := e.Sessions.GetLastCar(sid); ok {
+		if fresh, ok := e.Catalog.ByStockID(car.StockID); ok {
+			return fresh, true
+		}
+		// The reference kept across a reset has only the stock ID.
+		if car.Make != "" {
+			return car, true
+		}
+	}
+	if recs := e.Sessions.GetRecommendations(sid); len(recs) > 0 {
+		return recs[0], true
+	}
+	return catalog.Car{}, false
+}
+
+// reference is how a message refers to one of the last recommendations.
+type reference int
+
+const (
+	noReference reference = iota
+	// byPosition is "el segundo", "the last one": the list shown, never a
+	// new search.
+	byPosition
+	// byName is "el Mazda", "el CX-5", which may also ask for more of them.
+	byName
+)
+
+// resolveReference makes the car text refers to among the last
+// recommendations ("el segundo", "el Mazda") the session's last car and
+// returns how it was referred to. "Ese" and the like need no resolving:
+// they are the last car already.
+func (e *Engine) resolveReference(sid string, lang i18n.Lang, text string) reference {
+	car, ref := referencedCar(text, lang, e.Sessions.GetRecommendations(sid))
+	if ref != noReference {
+		e.Sessions.SetLastCar(sid, car)
+	}
+	return ref
+}
+
+// referencedCar finds the car of recs text, written in lang, refers to by
+// position, model or make. A name shared by several cars refers to the best
+// ranked one.
+func referencedCar(text string, lang i18n.Lang, recs []catalog.Car) (catalog.Car, reference) {
+	if len(recs) == 0 {
+		return catalog.Car{}, noReference
+	}
+	t := normalizeName(text)
+	re := ordinalRe
+	if lang == i18n.Portuguese {
+		re = ordinalPtRe
+	}
+	if m := re.FindStringSubmatch(t); m != nil {
+		n := ordinals[m[1]+m[2]]
+		if n == -1 {
+			n = len(recs)
+		}
+		if n >= 1 && n <= len(recs) {
+			return recs[n-1], byPosition
+		}
+	}
+	for _, car := range recs {
+		if mentionsModel(t, car) {
+			return car, byName
+		}
+	}
+	for _, car := range recs {
+		if containsWord(t, normalizeName(car.Make)) {
+			return car, byName
+		}
+	}
+	return catalog.Car{}, noReference
+}
+
+// mentionsModel reports whether normalized text t names the model of car.
+// Short models like "Uno", "Rio" or "208" are common words or numbers, so
+// they only count after the make or "el", "la" or "the".
+func mentionsModel(t string, car catalog.Car) bool {
+	model := normalizeName(car.Model)
+	if len(model) >= 4 {
+		return containsWord(t, model)
+	}
+	for _, before := range []string{normalizeName(car.Make), "el", "la", "the"} {
+		if before != "" && containsWord(t, before+" "+model) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsWord reports whether t has w as whole words.
+func containsWord(t, w string) bool {
+	if w == "" {
+		return false
+	}
+	for i := 0; ; {
+		j := strings.Index(t[i:], w)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(w)
+		if (start == 0 || !wordByte(t[start-1])) && (end == len(t) || !wordByte(t[end])) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func wordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b >= 0x80
+}
+
+// normalizeName lowercases s, drops its accents and collapses its spaces.
+func normalizeName(s string) string {
+	return refAccents.Replace(strings.Join(strings.Fields(strings.ToLower(s)), " "))
+}
+
+// recordStockIDs makes the car of an answer that talks about a single
+// catalog car the session's last car.
+func (e *Engine) recordStockIDs(sid string, ids []string) {
+	if len(ids) != 1 {
+		return
+	}
+	if car, ok := e.Catalog.ByStockID(ids[0]); ok {
+		e.Sessions.SetLastCar(sid, car)
+	}
+}
+
+// withLastCar returns history with the "Último auto recomendado" block of the
+// session's current car, built from the catalog. The block is sent on every
+// turn but not stored, so that the history never holds a stale one.
+func (e *Engine) withLastCar(sid string, lang i18n.Lang, history []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	car, ok := e.currentCar(sid)
+	if !ok {
+		return history
+	}
+	out := make([]openai.ChatCompletionMessage, 0, len(history)+1)
+	out = append(out, history...)
+	return append(out, openai.ChatCompletionMessage{
+		Role:    "system",
+		Content: recommendationsBlock(lang, i18n.Message(lang, i18n.LastCarHeader), []catalog.Car{car}, true),
+	})
+}
@@ -0,0 +1,69 @@
+package conversation
+
+import (
+	"testing"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+)
+
+func TestReferencedCar(t *testing.T) {
+	recs := []catalog.Car{
+		{StockID: "1", Make: "Volkswagen", Model: "Jetta"},
+		{StockID: "2", Make: "Mazda", Model: "CX-5"},
+		{StockID: "3", Make: "Kia", Model: "Rio"},
+	}
+	tests := []struct {
+		text    string
+		lang    i18n.Lang
+		stockID string
+		ref     reference
+	}{
+		{"quiero el segundo", i18n.Spanish, "2", byPosition},
+		{"me quedo con la última", i18n.Spanish, "3", byPosition},
+		{"la opción 1 por favor", i18n.Spanish, "1", byPosition},
+		{"I'll take the third one", i18n.English, "3", byPosition},
+		{"quero o segundo", i18n.Portuguese, "2", byPosition},
+		{"gostei da opção 3", i18n.Portuguese, "3", byPosition},
+		{"me interesa el Mazda", i18n.Spanish, "2", byName},
+		{"¿cuánto cuesta el   Jetta?", i18n.Spanish, "1", byName},
+		{"el Rio me gusta", i18n.Spanish, "3", byName},
+		{"¿tienes más Mazdas?", i18n.Spanish, "", noReference},
+		{"quiero ver pickups", i18n.Spanish, "", noReference},
+		{"el quinto", i18n.Spanish, "", noReference},
+		// "río" alone is a common word, not the Kia Rio.
+		{"vivo cerca del río", i18n.Spanish, "", noReference},
+		// "o" and "a" are only articles in Portuguese.
+		{"lo vi a segunda hora", i18n.Spanish, "", noReference},
+		{"uno u otro, o último recurso", i18n.Spanish, "", noReference},
+	}
+	for _, tt := range tests {
+		car, ref := referencedCar(tt.text, tt.lang, recs)
+		if ref != tt.ref || car.StockID != tt.stockID {
+			t.Errorf("referencedCar(%q) = %s, %d; want %s, %d", tt.text, car.StockID, ref, tt.stockID, tt.ref)
+		}
+	}
+	if _, ref := referencedCar("el segundo", i18n.Spanish, nil); ref != noReference {
+		t.Errorf("referenced a car without recommendations")
+	}
+}
+
+func TestResolveReferenceKeepsPickedCar(t *testing.T) {
+	e := newTestEngine(t, config.ExpiryConfig{})
+	e.Sessions.SetRecommendations("s1", testCars)
+	e.Sessions.SetLastCar("s1", testCars[0])
+
+	if ref := e.resolveReference("s1", i18n.Spanish, "quiero el segundo"); ref != byPosition {
+		t.Fatalf("reference %d, want by position", ref)
+	}
+	if car, _ := e.currentCar("s1"); car.StockID != testCars[1].StockID {
+		t.Errorf("current car %s, want the second recommendation", car.StockID)
+	}
+	if ref := e.resolveReference("s1", i18n.Spanish, "¿y qué tal está?"); ref != noReference {
+		t.Errorf("reference %d for a message that names no car", ref)
+	}
+	if car, _ := e.currentCar("s1"); car.StockID != testCars[1].StockID {
+		t.Errorf("current car changed to %s without a reference", car.StockID)
+	}
+}
@@ -0,0 +1,135 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/i18n"
+	"carlospayan/agent-comercial-ai/internal/intent"
+	"carlospayan/agent-comercial-ai/internal/media"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+	"carlospayan/agent-comercial-ai/internal/usage"
+)
+
+// Tags that stand for attachments in the history, where only text is stored.
+const (
+	photoTag = "[foto]"
+	audioTag = "[nota de voz]"
+	fileTag  = "[archivo]"
+)
+
+// RespondMedia answers a WhatsApp message with an attachment at url. caption
+// is the text sent along with it, possibly empty. Car photos are described
+// by the vision model and answered with a catalog search for similar cars;
+// voice notes are transcribed and answered like text.
+func (e *Engine) RespondMedia(ctx context.Context, sid, endpoint, caption, url, contentType string) (Reply, error) {
+	unlock, err := e.lock(ctx, sid)
+	if err != nil {
+		return Reply{}, err
+	}
+	defer unlock()
+
+	ctx = usage.WithScope(ctx, sid, endpoint, e.Sessions)
+	switch {
+	case media.IsImage(contentType) && e.Vision.Enabled():
+		return e.respondPhoto(ctx, sid, endpoint, caption, url, contentType)
+	case media.IsAudio(contentType) && e.Speech != nil:
+		return e.respondAudio(ctx, sid, endpoint, caption, url, contentType)
+	}
+	metrics.MediaMessages.WithLabelValues("other", "unsupported").Inc()
+	if strings.TrimSpace(caption) != "" {
+		return e.respond(ctx, sid, endpoint, message{text: caption}, nil)
+	}
+	return e.mediaReply(ctx, sid, fileTag, caption, i18n.MediaUnsupported), nil
+}
+
+func (e *Engine) respondPhoto(ctx context.Context, sid, endpoint, caption, url, contentType string) (Reply, error) {
+	file, err := e.Media.Fetch(ctx, url, contentType)
+	if errors.Is(err, media.ErrTooLarge) {
+		metrics.MediaMessages.WithLabelValues("image", "too_large").Inc()
+		return e.mediaReply(ctx, sid, photoTag, caption, i18n.MediaTooLarge), nil
+	}
+	if err != nil {
+		log.Printf("conversation: session %s: %v", sid, err)
+		metrics.MediaMessages.WithLabelValues("image", "error").Inc()
+		return e.mediaReply(ctx, sid, photoTag, caption, i18n.PhotoUnreadable), nil
+	}
+
+	desc, err := e.Vision.Describe(ctx, file)
+	if err != nil {
+		log.Printf("conversation: session %s: %v", sid, err)
+		metrics.MediaMessages.WithLabelValues("image", "error").Inc()
+		return e.mediaReply(ctx, sid, photoTag, caption, i18n.PhotoUnreadable), nil
+	}
+	if !desc.IsCar {
+		metrics.MediaMessages.WithLabelValues("image", "not_car").Inc()
+		return e.mediaReply(ctx, sid, photoTag, caption, i18n.PhotoNotCar), nil
+	}
+	metrics.MediaMessages.WithLabelValues("image", "ok").Inc()
+
+	variant, lang := e.startSession(ctx, sid, caption)
+	text := fmt.Sprintf(i18n.Message(lang, i18n.PhotoQuery), desc.Query())
+	if c := strings.TrimSpace(caption); c != "" {
+		text = c + "\n" + text
+	}
+	return e.respond(ctx, sid, endpoint, message{
+		text:    text,
+		intent:  intent.CatalogSearch,
+		tag:     photoTag,
+		started: &session{variant: variant, lang: lang},
+	}, nil)
+}
+
+// respondAudio transcribes a voice note and answers the transcript, which is
+// kept in the history with the voice note tag.
+func (e *Engine) respondAudio(ctx context.Context, sid, endpoint, caption, url, contentType string) (Reply, error) {
+	file, err := e.Media.Fetch(ctx, url, contentType)
+	if errors.Is(err, media.ErrTooLarge) {
+		metrics.MediaMessages.WithLabelValues("audio", "too_large").Inc()
+		return e.mediaReply(ctx, sid, audioTag, caption, i18n.MediaTooLarge), nil
+	}
+	if err != nil {
+		log.Printf("conversation: session %s: %v", sid, err)
+		metrics.MediaMessages.WithLabelValues("audio", "error").Inc()
+		return e.mediaReply(ctx, sid, audioTag, caption, i18n.AudioUnreadable), nil
+	}
+
+	start := time.Now()
+	transcript, err := e.Speech.Transcribe(ctx, file)
+	metrics.TranscriptionLatency.Observe(float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		log.Printf("conversation: session %s: %v", sid, err)
+		metrics.MediaMessages.WithLabelValues("audio", "error").Inc()
+		return e.mediaReply(ctx, sid, audioTag, caption, i18n.AudioUnreadable), nil
+	}
+	if transcript == "" {
+		metrics.MediaMessages.WithLabelValues("audio", "empty").Inc()
+		return e.mediaReply(ctx, sid, audioTag, caption, i18n.AudioUnreadable), nil
+	}
+	metrics.MediaMessages.WithLabelValues("audio", "ok").Inc()
+
+	if c := strings.TrimSpace(caption); c != "" {
+		transcript = c + "\n" + transcript
+	}
+	return e.respond(ctx, sid, endpoint, message{text: transcript, tag: audioTag}, nil)
+}
+
+// mediaReply answers an attachment that couldn't be used with the canned
+// message key, and records the turn as tag plus caption.
+func (e *Engine) mediaReply(ctx context.Context, sid, tag, caption string, key i18n.Key) Reply {
+	_, lang := e.startSession(ctx, sid, caption)
+	text := i18n.Message(lang, key)
+	if key == i18n.MediaTooLarge {
+		mb := e.Media.MaxBytes() >> 20
+		if mb < 1 {
+			mb = 1
+		}
+		text = fmt.Sprintf(text, mb)
+	}
+	e.storeTurn(sid, strings.TrimSpace(tag+" "+caption), text)
+	return Reply{Text: text, Lang: lang}
+}
@@ -0,0 +1,116 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/customer"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+	"carlospayan/agent-comercial-ai/internal/intent"
+)
+
+var (
+	// showProfileRe and deleteProfileRe are the whole messages that show and
+	// delete the customer's profile, after normalizing.
+	showProfileRe   = regexp.MustCompile(`^(?:ver |show )?(?:mis datos|mi perfil|que sabes de mi|my data|my profile|what do you know about me|meus dados|meu perfil|o que voce sabe de mim)$`)
+	deleteProfileRe = regexp.MustCompile(`^(?:(?:borra|borrar|elimina|eliminar) (?:mis datos|mi perfil)|olvidame|delete my (?:data|profile)|forget me|(?:apagar|apague|excluir|exclua) (?:meus dados|meu perfil)|me esqueca)$`)
+)
+
+// profileCommand answers a request to see or delete the customer's profile.
+// These turns aren't stored so that the history doesn't keep a profile
+// that was deleted. Deleting it also forgets session sid, whose history
+// has the profile note since it started.
+func (e *Engine) profileCommand(ctx context.Context, sid string, lang i18n.Lang, text string) (string, bool) {
+	id := customer.ID(ctx)
+	if !e.Profiles.Enabled || id == "" {
+		return "", false
+	}
+	t := strings.Trim(normalizeName(text), " .!?¿¡,")
+	for _, please := range []string{" por favor", " please"} {
+		t = strings.Trim(strings.TrimSuffix(t, please), " ,")
+	}
+	switch {
+	case deleteProfileRe.MatchString(t):
+		e.Sessions.DeleteProfile(id)
+		e.Sessions.DeleteHistory(sid)
+		log.Printf("conversation: customer %s deleted their profile", id)
+		return i18n.Message(lang, i18n.ProfileDeleted), true
+	case showProfileRe.MatchString(t):
+		p, ok := e.Sessions.GetProfile(id)
+		if !ok || p.Empty() {
+			return i18n.Message(lang, i18n.ProfileEmpty), true
+		}
+		return fmt.Sprintf(i18n.Message(lang, i18n.ProfileView), "- "+strings.Join(profileLines(lang, p), "\n- ")), true
+	}
+	return "", false
+}
+
+// updateProfile adds the preferences the customer states in text to their
+// profile. Trade-in messages describe the customer's own car, not the one
+// they look for, so they are skipped.
+func (e *Engine) updateProfile(ctx context.Context, text string, in intent.Intent) {
+	id := customer.ID(ctx)
+	if !e.Profiles.Enabled || id == "" || in == intent.TradeIn {
+		return
+	}
+	p, _ := e.Sessions.GetProfile(id)
+	p, changed := e.Preferences.Extract(text, p)
+	if (in == intent.Financing || in == intent.Affordability) && !p.Financing {
+		p.Financing, changed = true, true
+	}
+	if !changed {
+		return
+	}
+	p.UpdatedAt = time.Now()
+	e.Sessions.SetProfile(id, p)
+}
+
+// rememberProfile adds the system note with the customer's profile to a
+// conversation that starts, so that they don't have to repeat it.
+func (e *Engine) rememberProfile(ctx context.Context, sid string, lang i18n.Lang) {
+	id := customer.ID(ctx)
+	if !e.Profiles.Enabled || id == "" {
+		return
+	}
+	p, ok := e.Sessions.GetProfile(id)
+	if !ok || p.Empty() {
+		return
+	}
+	e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+		Role:    "system",
+		Content: fmt.Sprintf(i18n.Message(lang, i18n.ProfileNote), strings.Join(profileLines(lang, p), "; ")),
+	})
+}
+
+// profileLines describes each preference of p in lang.
+func profileLines(lang i18n.Lang, p customer.Profile) []string {
+	var lines []string
+	if p.Budget > 0 {
+		lines = append(lines, fmt.Sprintf(i18n.Message(lang, i18n.ProfileBudget), i18n.FormatMXN(lang, p.Budget)))
+	}
+	if p.MonthlyBudget > 0 {
+		lines = append(lines, fmt.Sprintf(i18n.Message(lang, i18n.ProfileMonthlyBudget), i18n.FormatMXN(lang, p.MonthlyBudget)))
+	}
+	if len(p.Makes) > 0 {
+		lines = append(lines, fmt.Sprintf(i18n.Message(lang, i18n.ProfileMakes), strings.Join(p.Makes, ", ")))
+	}
+	if len(p.BodyTypes) > 0 {
+		lines = append(lines, fmt.Sprintf(i18n.Message(lang, i18n.ProfileBodyTypes), strings.Join(p.BodyTypes, ", ")))
+	}
+	if p.FamilySize > 0 {
+		lines = append(lines, fmt.Sprintf(i18n.Message(lang, i18n.ProfileFamilySize), p.FamilySize))
+	}
+	if p.City != "" {
+		lines = append(lines, fmt.Sprintf(i18n.Message(lang, i18n.ProfileCity), p.City))
+	}
+	if p.Financing {
+		lines = append(lines, i18n.Message(lang, i18n.ProfileFinancing))
+	}
+	return lines
+}
@@ -0,0 +1,81 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/customer"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+)
+
+func newProfileEngine(t *testing.T) *Engine {
+	t.Helper()
+	e := newTestEngine(t, config.ExpiryConfig{})
+	e.Profiles.Enabled = true
+	e.Preferences = customer.NewExtractor(e.Catalog)
+	e.Sessions.SetProfile("c1", customer.Profile{City: "Puebla"})
+	return e
+}
+
+// profileNote returns the profile note of sid's history, if any.
+func profileNote(e *Engine, sid string) (string, bool) {
+	for _, m := range e.Sessions.GetHistory(sid) {
+		if m.Role == "system" && strings.Contains(m.Content, "conversaciones anteriores") {
+			return m.Content, true
+		}
+	}
+	return "", false
+}
+
+func TestRememberProfileInSessionLanguage(t *testing.T) {
+	e := newProfileEngine(t)
+	ctx := customer.WithID(context.Background(), "c1")
+	for lang, text := range map[i18n.Lang]string{i18n.Spanish: "hola, busco un auto", i18n.English: "hello, I am looking for a car"} {
+		sid := string(lang)
+		if _, got := e.startSession(ctx, sid, text); got != lang {
+			t.Fatalf("%q detected as %s", text, got)
+		}
+		note, ok := profileNote(e, sid)
+		if !ok {
+			t.Fatalf("%s conversation started without the profile note", lang)
+		}
+		if city := fmt.Sprintf(i18n.Message(lang, i18n.ProfileCity), "Puebla"); !strings.Contains(note, city) {
+			t.Errorf("%s note %q, want %q", lang, note, city)
+		}
+	}
+}
+
+func TestDeleteProfileForgetsSession(t *testing.T) {
+	e := newProfileEngine(t)
+	ctx := customer.WithID(context.Background(), "c1")
+	if _, err := e.Respond(ctx, "s1", "test", "quiero hablar con un asesor", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := profileNote(e, "s1"); !ok {
+		t.Fatalf("conversation started without the profile note")
+	}
+
+	reply, err := e.Respond(ctx, "s1", "test", "Borrar mis datos, por favor", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Text != i18n.Message(i18n.Spanish, i18n.ProfileDeleted) {
+		t.Errorf("reply %q, want the deletion confirmation", reply.Text)
+	}
+	if _, ok := e.Sessions.GetProfile("c1"); ok {
+		t.Errorf("profile still stored")
+	}
+	if hist := e.Sessions.GetHistory("s1"); len(hist) != 0 {
+		t.Errorf("conversation kept %d messages after deleting the profile", len(hist))
+	}
+
+	if _, err := e.Respond(ctx, "s1", "test", "quiero hablar con un asesor", nil); err != nil {
+		t.Fatal(err)
+	}
+	if note, ok := profileNote(e, "s1"); ok {
+		t.Errorf("next conversation has the deleted profile: %q", note)
+	}
+}
@@ -0,0 +1,184 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/critique"
+	"carlospayan/agent-comercial-ai/internal/experiments"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+	"carlospayan/agent-comercial-ai/internal/intent"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+)
+
+// startSession assigns the session its experiment variant and, when a
+// conversation starts, stores the system instructions and the Kavak info
+// block that open it, in the language of text. A conversation that expired
+// is ended first, and a user who comes back after that is welcomed back.
+// The customer's profile, if any, is offered to every new conversation.
+func (e *Engine) startSession(ctx context.Context, sid, text string) (experiments.Variant, i18n.Lang) {
+	variant := e.Experiment.Assign(sid)
+	activity, returning := e.Sessions.Activity(sid)
+	if len(e.Sessions.GetHistory(sid)) > 0 {
+		if !e.expired(activity, time.Now()) {
+			return variant, e.switchLanguage(sid, text)
+		}
+		e.resetSession(sid, "returning")
+	}
+
+	lang, _ := i18n.Detect(text)
+	version, system := e.Prompts.System(variant.PromptVersion, lang)
+	e.Sessions.SetPromptVersion(sid, version)
+	e.Sessions.SetVariant(sid, variant.Name)
+	e.Sessions.SetLanguage(sid, lang)
+	e.Experiment.RecordSession(variant)
+
+	e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+		Role:    "system",
+		Content: system,
+	})
+	e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+		Role:    "assistant",
+		Content: i18n.Message(lang, i18n.KavakInfoHeader) + "\n" + e.kavakInfo(),
+	})
+	if returning {
+		e.welcomeBack(sid, lang)
+	}
+	e.rememberProfile(ctx, sid, lang)
+	return variant, lang
+}
+
+// switchLanguage returns the session language, following the user when a
+// message is clearly written in another one. The system prompt stays as it
+// was; a system note tells the model to answer in the new language.
+func (e *Engine) switchLanguage(sid, text string) i18n.Lang {
+	current, ok := e.Sessions.GetLanguage(sid)
+	if !ok {
+		current = i18n.Default
+	}
+	lang, sure := i18n.Detect(text)
+	if !sure || lang == current {
+		return current
+	}
+	e.Sessions.SetLanguage(sid, lang)
+	e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+		Role:    "system",
+		Content: fmt.Sprintf(i18n.Message(lang, i18n.SwitchLanguage), lang.Name(), lang.Name()),
+	})
+	return lang
+}
+
+// recommendationsBlock lists autos for the model with prices and mileage in
+// the format of lang. withStockIDs adds the stock IDs that structured
+// answers refer to.
+func recommendationsBlock(lang i18n.Lang, header string, autos []catalog.Car, withStockIDs bool) string {
+	var recs []string
+	for i, a := range autos {
+		rec := fmt.Sprintf(
+			i18n.Message(lang, i18n.RecommendationLine),
+			i+1, a.Make, a.Model, a.Version, a.Year,
+			i18n.FormatMXN(lang, a.Price), i18n.FormatNumber(lang, float64(a.KM), 0),
+		)
+		if withStockIDs {
+			rec += fmt.Sprintf(" [stock_id: %s]", a.StockID)
+		}
+		recs = append(recs, rec)
+	}
+	return header + "\n" + strings.Join(recs, "\n")
+}
+
+// ground checks answer against the catalog and the session's last
+// recommendations. When the grounding action is "regenerate" the model is
+// asked again with the same history plus a note listing what was wrong.
+func (e *Engine) ground(ctx context.Context, sid, model string, history []openai.ChatCompletionMessage, answer string) string {
+	return e.Grounding.Apply(ctx, sid, answer, e.Sessions.GetRecommendations(sid), e.regenerate(model, history, answer))
+}
+
+// critique runs the second pass configured for the intent, e.g. checking the
+// numbers of a financing answer against the calculation.
+func (e *Engine) critique(ctx context.Context, sid string, in intent.Intent, lang i18n.Lang, model string, history []openai.ChatCompletionMessage, answer string) string {
+	facts := critique.Facts{
+		Recent:  e.Sessions.GetRecommendations(sid),
+		Profile: e.Sessions.GetFinancingTerms(sid).Profile,
+	}
+	return e.Critique.Apply(ctx, sid, in, lang, answer, facts, e.regenerate(model, history, answer))
+}
+
+// regenerate asks the model again with the same history, its previous answer
+// and a system note saying what to fix.
+func (e *Engine) regenerate(model string, history []openai.ChatCompletionMessage, answer string) func(context.Context, string) (string, error) {
+	return func(ctx context.Context, note string) (string, error) {
+		retry := append([]openai.ChatCompletionMessage{}, history...)
+		retry = append(retry,
+			openai.ChatCompletionMessage{Role: "assistant", Content: answer},
+			openai.ChatCompletionMessage{Role: "system", Content: note},
+		)
+		return e.Client.Chat(ctx, model, retry)
+	}
+}
+
+// quoteRequest finds the car and terms of a financing answer: the car is the
+// recommended (or else catalog) car with the stated price, or the session's
+// current car when the answer states none.
+func (e *Engine) quoteRequest(sid, answer string) *QuoteRequest {
+	price, down, years, ok := critique.Terms(answer)
+	if !ok {
+		return nil
+	}
+	recs := e.Sessions.GetRecommendations(sid)
+	profile := e.Sessions.GetFinancingTerms(sid).Profile
+	if price == 0 {
+		car, ok := e.currentCar(sid)
+		if !ok {
+			return nil
+		}
+		return &QuoteRequest{StockID: car.StockID, DownPayment: down, Years: years, Profile: profile}
+	}
+	for _, cars := range [][]catalog.Car{recs, e.Catalog.Cars()} {
+		for _, car := range cars {
+			if math.Abs(car.Price-price) <= 1 {
+				return &QuoteRequest{StockID: car.StockID, DownPayment: down, Years: years, Profile: profile}
+			}
+		}
+	}
+	return nil
+}
+
+// cacheScope returns the response cache scope for the session, or false when
+// the answer depends on the session and can't come from the cache.
+func (e *Engine) cacheScope(sid string, variant experiments.Variant, lang i18n.Lang, in intent.Intent) (string, bool) {
+	if !e.Cache.Enabled() {
+		return "", false
+	}
+	if !in.SessionIndependent() {
+		e.Cache.Skip()
+		return "", false
+	}
+	version, _ := e.Sessions.GetPromptVersion(sid)
+	return variant.Name + "/" + version + "/" + string(lang), true
+}
+
+// storeTurn records a turn answered without the LLM so that the conversation
+// history stays complete.
+func (e *Engine) storeTurn(sid, q, answer string) {
+	e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+		Role:    "user",
+		Content: q,
+	})
+	e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+		Role:    "assistant",
+		Content: answer,
+	})
+}
+
+func (e *Engine) countTurn(sid, endpoint string, variant experiments.Variant, in intent.Intent) {
+	version, _ := e.Sessions.GetPromptVersion(sid)
+	metrics.ConversationTurns.WithLabelValues(endpoint, version, variant.Name, string(in)).Inc()
+	e.Experiment.RecordTurn(variant)
+}
@@ -0,0 +1,183 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+)
+
+// Follow-up actions the model may suggest; channels render them as buttons.
+const (
+	ActionQuotePrice    = "cotizar_precio"
+	ActionSimulate      = "simular_financiamiento"
+	ActionMoreOptions   = "ver_mas_opciones"
+	ActionCompare       = "comparar_autos"
+	ActionScheduleVisit = "agendar_visita"
+	ActionTalkToAdvisor = "hablar_con_asesor"
+)
+
+var actions = []string{ActionQuotePrice, ActionSimulate, ActionMoreOptions, ActionCompare, ActionScheduleVisit, ActionTalkToAdvisor}
+
+// Structured is the JSON answer the model is asked for.
+type Structured struct {
+	Message  string   `json:"message"`
+	StockIDs []string `json:"stock_ids"`
+	Actions  []string `json:"actions"`
+}
+
+type rawSchema string
+
+func (s rawSchema) MarshalJSON() ([]byte, error) {
+	return []byte(s), nil
+}
+
+var structuredSchema = rawSchema(`{
+  "type": "object",
+  "properties": {
+    "message": {"type": "string"},
+    "stock_ids": {"type": "array", "items": {"type": "string"}},
+    "actions": {"type": "array", "items": {"type": "string", "enum": ["` + strings.Join(actions, `","`) + `"]}}
+  },
+  "required": ["message", "stock_ids", "actions"],
+  "additionalProperties": false
+}`)
+
+// structuredInstructions is sent after the history on every structured turn
+// and never stored, so the history only holds the plain message text.
+var structuredInstructions = `Responde ÚNICAMENTE con un objeto JSON con esta forma:
+{"message": "<tu respuesta al usuario, en su idioma y en el formato y tono habituales>", "stock_ids": ["<stock_id de cada auto del catálogo que menciones>"], "actions": ["<acciones sugeridas>"]}
+Las acciones posibles son: ` + strings.Join(actions, ", ") + `.
+Usa solo stock_id que aparezcan en las recomendaciones; si no mencionas autos, deja la lista vacía.`
+
+func (e *Engine) responseFormat() *openai.ChatCompletionResponseFormat {
+	if e.Structured.StrictSchema {
+		return &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   "kavak_reply",
+				Schema: structuredSchema,
+				Strict: true,
+			},
+		}
+	}
+	return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+}
+
+// chatStructured asks for a JSON answer and validates it. Unknown stock IDs
+// and actions are dropped; an answer that isn't valid JSON with a message is
+// replaced by a plain text one (see plainFallback).
+func (e *Engine) chatStructured(ctx context.Context, model string, history []openai.ChatCompletionMessage) (Structured, error) {
+	messages := append(append([]openai.ChatCompletionMessage{}, history...), openai.ChatCompletionMessage{
+		Role:    "system",
+		Content: structuredInstructions,
+	})
+	raw, err := e.Client.ChatFormat(ctx, model, messages, e.responseFormat())
+	if err != nil {
+		return Structured{}, err
+	}
+
+	var out Structured
+	if err := json.Unmarshal([]byte(raw), &out); err != nil || strings.TrimSpace(out.Message) == "" {
+		metrics.StructuredOutputs.WithLabelValues("fallback").Inc()
+		return e.plainFallback(ctx, model, history, raw)
+	}
+
+	result := "ok"
+	out.StockIDs, result = validStockIDs(e.Catalog, out.StockIDs, result)
+	out.Actions, result = validActions(out.Actions, result)
+	metrics.StructuredOutputs.WithLabelValues(result).Inc()
+	return out, nil
+}
+
+// plainFallback answers a turn whose JSON answer raw couldn't be read,
+// usually because the token limit cut it off: the model is asked again
+// without the JSON instructions, and if that fails the message raw got to
+// say is used.
+func (e *Engine) plainFallback(ctx context.Context, model string, history []openai.ChatCompletionMessage, raw string) (Structured, error) {
+	text, err := e.Client.Chat(ctx, model, history)
+	if err == nil && strings.TrimSpace(text) != "" {
+		return Structured{Message: text}, nil
+	}
+	if err == nil {
+		err = errors.New("empty answer")
+	}
+	if msg := partialMessage(raw); msg != "" {
+		log.Printf("conversation: plain answer after unreadable JSON failed, using its partial message: %v", err)
+		return Structured{Message: msg}, nil
+	}
+	return Structured{}, fmt.Errorf("error getting a plain answer after unreadable JSON: %w", err)
+}
+
+var messageKeyRe = regexp.MustCompile(`"message"\s*:\s*"`)
+
+// partialMessage returns the message of a JSON answer that may be cut off,
+// ending it with "…" when it is, or "" when raw has no message.
+func partialMessage(raw string) string {
+	loc := messageKeyRe.FindStringIndex(raw)
+	if loc == nil {
+		return ""
+	}
+	s := raw[loc[1]:]
+	end, cut := len(s), true
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == '"' {
+			end, cut = i, false
+			break
+		}
+	}
+	body := s[:end]
+	// A cut off message can end in the middle of an escape sequence.
+	for trim := 0; trim <= len(`\u0000`) && trim <= len(body); trim++ {
+		var msg string
+		if json.Unmarshal([]byte(`"`+body[:len(body)-trim]+`"`), &msg) != nil {
+			continue
+		}
+		msg = strings.TrimSpace(msg)
+		if cut && msg != "" {
+			msg += "…"
+		}
+		return msg
+	}
+	return ""
+}
+
+func validStockIDs(cat *catalog.Catalog, ids []string, result string) ([]string, string) {
+	valid := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := cat.ByStockID(id); ok {
+			valid = append(valid, id)
+		} else {
+			result = "invalid"
+		}
+	}
+	return valid, result
+}
+
+func validActions(in []string, result string) ([]string, string) {
+	valid := make([]string, 0, len(in))
+	for _, a := range in {
+		known := false
+		for _, k := range actions {
+			known = known || a == k
+		}
+		if known {
+			valid = append(valid, a)
+		} else {
+			result = "invalid"
+		}
+	}
+	return valid, result
+}
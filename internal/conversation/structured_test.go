@@ -0,0 +1,92 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/llm"
+)
+
+func TestPartialMessage(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{`{"message": "Hola", "stock_ids": [], "actions": []}`, "Hola"},
+		{`{"message": "El Mazda CX-5 cuesta 396,999 MXN y`, "El Mazda CX-5 cuesta 396,999 MXN y…"},
+		{`{"message": "Te recomiendo el \"Mazda\" por`, `Te recomiendo el "Mazda" por…`},
+		{`{"message": "Línea 1\nLínea 2 \u00e`, "Línea 1\nLínea 2…"},
+		{`{"message": "Cuesta \`, "Cuesta…"},
+		{`{"stock_ids": ["243587"]`, ""},
+		{`{"message": "`, ""},
+		{`no es JSON`, ""},
+	}
+	for _, tt := range tests {
+		if got := partialMessage(tt.raw); got != tt.want {
+			t.Errorf("partialMessage(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+// fakeOpenAI answers chat completions that ask for JSON with answer and the
+// rest with plain, or with an error when plain is empty.
+func fakeOpenAI(t *testing.T, answer, plain string) *llm.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		content := answer
+		if req.ResponseFormat == nil {
+			if plain == "" {
+				http.Error(w, `{"error": {"message": "unavailable"}}`, http.StatusServiceUnavailable)
+				return
+			}
+			content = plain
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: content}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	cfg := openai.DefaultConfig("test")
+	cfg.BaseURL = server.URL
+	return llm.NewClientConfig(cfg)
+}
+
+func TestChatStructuredTruncated(t *testing.T) {
+	truncated := `{"message": "El Mazda CX-5 Grand Touring 2019 cuesta 396,999 MXN y tiene 42,000 km. Si te interesa`
+	history := []openai.ChatCompletionMessage{{Role: "user", Content: "¿cuánto cuesta el Mazda?"}}
+	tests := []struct {
+		name, plain, want string
+	}{
+		{"asks again", "El Mazda CX-5 cuesta 396,999 MXN.", "El Mazda CX-5 cuesta 396,999 MXN."},
+		{"partial message", "", "El Mazda CX-5 Grand Touring 2019 cuesta 396,999 MXN y tiene 42,000 km. Si te interesa…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t, config.ExpiryConfig{})
+			e.Client = fakeOpenAI(t, truncated, tt.plain)
+			out, err := e.chatStructured(context.Background(), "test", history)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.Message != tt.want {
+				t.Errorf("message %q, want %q", out.Message, tt.want)
+			}
+		})
+	}
+
+	e := newTestEngine(t, config.ExpiryConfig{})
+	e.Client = fakeOpenAI(t, `{"stock_ids": ["243587"`, "")
+	if out, err := e.chatStructured(context.Background(), "test", history); err == nil {
+		t.Errorf("answer without a message and no plain answer gave %q", out.Message)
+	}
+}
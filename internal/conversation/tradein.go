@@ -0,0 +1,112 @@
+package conversation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/i18n"
+	"carlospayan/agent-comercial-ai/internal/intent"
+	"carlospayan/agent-comercial-ai/internal/tradein"
+)
+
+var tradeInFields = map[string]string{
+	tradein.FieldMake:    "marca",
+	tradein.FieldModel:   "modelo",
+	tradein.FieldYear:    "año",
+	tradein.FieldVersion: "versión",
+	tradein.FieldKM:      "kilometraje",
+}
+
+// continuesTradeIn reports whether text answers the trade-in flow's pending
+// question. A message that gives no data and has a clear intent of its own
+// leaves the flow, keeping what was collected.
+func (e *Engine) continuesTradeIn(sid, text string) bool {
+	if e.TradeInParser == nil {
+		return false
+	}
+	t := e.Sessions.GetTradeIn(sid)
+	if !t.Active() {
+		return false
+	}
+	if _, ok := e.TradeInParser.Parse(text, t.Car, t.Pending); ok {
+		return true
+	}
+	if _, ok := intent.Rules(text); !ok {
+		return true
+	}
+	t.Pending = ""
+	e.Sessions.SetTradeIn(sid, t)
+	return false
+}
+
+// tradeIn runs a turn of the trade-in flow: it stores the data text gives
+// about the customer's car and adds a system note telling the model what to
+// ask next or, once the car is complete, its valuation. The offer becomes
+// part of the down payment of later simulations.
+func (e *Engine) tradeIn(sid, text string) {
+	if e.TradeInParser == nil || e.TradeIn == nil {
+		return
+	}
+	t := e.Sessions.GetTradeIn(sid)
+	car, changed := e.TradeInParser.Parse(text, t.Car, t.Pending)
+	t.Car = car
+
+	var note string
+	if missing := car.Missing(); len(missing) > 0 {
+		t.Pending = missing[0]
+		note = fmt.Sprintf("Toma de auto a cuenta. Datos del auto del usuario hasta ahora: %s. Falta: %s. "+
+			"Pídele amablemente solo ese dato; la versión puede no saberla.",
+			describeTradeIn(car), tradeInFields[missing[0]])
+	} else {
+		t.Pending = ""
+		if changed || t.Valuation == nil {
+			t.Valuation = nil
+			if v, err := e.TradeIn.Value(car); err == nil {
+				t.Valuation = &v
+			}
+		}
+		terms := e.Sessions.GetFinancingTerms(sid)
+		if t.Valuation != nil {
+			terms.TradeIn = t.Valuation.Offer
+			note = fmt.Sprintf("Valuación estimada por el sistema del auto a cuenta (%s): rango de %s a %s MXN, oferta estimada %s MXN, "+
+				"basada en %d autos comparables del catálogo. Preséntala como estimación sujeta a inspección física, explica que la oferta se "+
+				"usará como enganche en las simulaciones de financiamiento y pregunta si quiere simular el financiamiento de algún auto.",
+				describeTradeIn(car), i18n.NoteAmount(t.Valuation.Low), i18n.NoteAmount(t.Valuation.High), i18n.NoteAmount(t.Valuation.Offer), t.Valuation.Comparables)
+		} else {
+			terms.TradeIn = 0
+			note = fmt.Sprintf("No hay autos comparables en el catálogo para estimar el valor del auto a cuenta (%s). "+
+				"Dilo con amabilidad y ofrece agendar una inspección o hablar con un asesor para valuarlo.", describeTradeIn(car))
+		}
+		e.Sessions.SetFinancingTerms(sid, terms)
+	}
+	e.Sessions.SetTradeIn(sid, t)
+	e.Sessions.AppendMessage(sid, openai.ChatCompletionMessage{
+		Role:    "system",
+		Content: note,
+	})
+}
+
+func describeTradeIn(car tradein.Car) string {
+	var parts []string
+	if car.Make != "" {
+		parts = append(parts, "marca "+car.Make)
+	}
+	if car.Model != "" {
+		parts = append(parts, "modelo "+car.Model)
+	}
+	if car.Year != 0 {
+		parts = append(parts, fmt.Sprintf("año %d", car.Year))
+	}
+	if car.Version != "" {
+		parts = append(parts, "versión "+car.Version)
+	}
+	if car.KM != 0 {
+		parts = append(parts, fmt.Sprintf("%s km", strings.TrimSuffix(i18n.NoteAmount(float64(car.KM)), ".00")))
+	}
+	if len(parts) == 0 {
+		return "ninguno"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,128 @@
+package critique
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+	"carlospayan/agent-comercial-ai/internal/intent"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+)
+
+const defaultTolerance = 0.001
+
+// check inspects an answer. It returns false when the answer has nothing to
+// check; otherwise the problems found (none if the answer is right), a note
+// telling the model the correct values and a function that fixes the answer
+// in place when regenerating doesn't help.
+type check func(c *Checker, answer string, facts Facts) (result, bool)
+
+// Facts is what the conversation knows that an answer must agree with.
+type Facts struct {
+	// Recent are the last recommended cars, most relevant first.
+	Recent []catalog.Car
+	// Profile is the credit profile the user declared, if any.
+	Profile financing.Profile
+}
+
+type result struct {
+	problems []string
+	note     string
+	rewrite  func(answer string, lang i18n.Lang) string
+}
+
+var checks = map[intent.Intent]check{
+	intent.Financing: checkFinancing,
+}
+
+// Checker runs a second pass over the answers of the configured intents and
+// regenerates the ones whose numbers don't match the calculation.
+type Checker struct {
+	intents   map[intent.Intent]bool
+	tolerance float64
+	calc      *financing.Calculator
+}
+
+func NewChecker(cfg config.CritiqueConfig, calc *financing.Calculator) *Checker {
+	intents := make(map[intent.Intent]bool)
+	for _, name := range cfg.Intents {
+		in := intent.Intent(name)
+		if _, ok := checks[in]; !ok {
+			log.Printf("critique: no check for intent %q, ignoring", name)
+			continue
+		}
+		intents[in] = true
+	}
+	tolerance := cfg.Tolerance
+	if tolerance <= 0 {
+		tolerance = defaultTolerance
+	}
+	return &Checker{
+		intents:   intents,
+		tolerance: tolerance,
+		calc:      calc,
+	}
+}
+
+// Enabled reports whether answers for in are checked.
+func (c *Checker) Enabled(in intent.Intent) bool {
+	return c != nil && c.intents[in]
+}
+
+// Apply returns the answer to send for intent in. When the answer's numbers
+// are wrong, regenerate is called once with the correct values; if the new
+// answer is still wrong, its numbers are replaced with the calculated ones.
+func (c *Checker) Apply(ctx context.Context, sessionID string, in intent.Intent, lang i18n.Lang, answer string, facts Facts, regenerate func(ctx context.Context, note string) (string, error)) string {
+	if !c.Enabled(in) {
+		return answer
+	}
+	start := time.Now()
+	defer func() {
+		metrics.CritiqueLatency.WithLabelValues(string(in)).Observe(float64(time.Since(start).Milliseconds()))
+	}()
+
+	res, ok := checks[in](c, answer, facts)
+	if !ok {
+		metrics.CritiqueChecks.WithLabelValues(string(in), "skipped").Inc()
+		return answer
+	}
+	if len(res.problems) == 0 {
+		metrics.CritiqueChecks.WithLabelValues(string(in), "ok").Inc()
+		return answer
+	}
+	c.report(sessionID, in, res.problems)
+
+	regenerated, err := regenerate(ctx, res.note)
+	if err != nil {
+		log.Printf("critique: session %s: regenerate failed: %v", sessionID, err)
+		metrics.CritiqueChecks.WithLabelValues(string(in), "rewritten").Inc()
+		return res.rewrite(answer, lang)
+	}
+	again, ok := checks[in](c, regenerated, facts)
+	if !ok || len(again.problems) == 0 {
+		metrics.CritiqueChecks.WithLabelValues(string(in), "regenerated").Inc()
+		return regenerated
+	}
+	c.report(sessionID, in, again.problems)
+	metrics.CritiqueChecks.WithLabelValues(string(in), "rewritten").Inc()
+	return again.rewrite(regenerated, lang)
+}
+
+func (c *Checker) report(sessionID string, in intent.Intent, problems []string) {
+	for _, p := range problems {
+		log.Printf("critique: session %s: %s: %s", sessionID, in, p)
+	}
+}
+
+// within reports whether claimed is close enough to expected.
+func (c *Checker) within(claimed, expected float64) bool {
+	diff := claimed - expected
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= 1 || diff <= c.tolerance*expected
+}
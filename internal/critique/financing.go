@@ -0,0 +1,172 @@
+package critique
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/grounding"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+)
+
+// Labels of the financing answer lines, in the languages of the prompts.
+var (
+	priceLabel     = regexp.MustCompile(`(?i)\b(precio|price|preço)\s*:`)
+	downLabel      = regexp.MustCompile(`(?i)\b(enganche|down payment|entrada)\s*:`)
+	financedLabel  = regexp.MustCompile(`(?i)\b(importe financiado|monto financiado|monto a financiar|financed amount|amount financed|valor financiado)\s*:`)
+	termLabel      = regexp.MustCompile(`(?i)\b(plazo|term|prazo)\s*:`)
+	monthlyLabel   = regexp.MustCompile(`(?i)\b(pago mensual|mensualidad|monthly payment|parcela mensal)[^:]*:`)
+	totalLabel     = regexp.MustCompile(`(?i)\b(total pagado|total paid|total pago)\s*:`)
+	interestLabel  = regexp.MustCompile(`(?i)\b(total (de )?intereses|total interest|total de juros)\s*:`)
+	insuranceLabel = regexp.MustCompile(`(?i)\b(seguro mensual|monthly insurance|seguro mensal)\s*:`)
+	termYearsRe    = regexp.MustCompile(`(?i)(\d+)\s*(años|anos|years?)`)
+	termMonthsRe   = regexp.MustCompile(`(?i)(\d+)\s*(meses|months?)`)
+	financingLines = []*regexp.Regexp{priceLabel, downLabel, financedLabel, monthlyLabel, insuranceLabel, totalLabel, interestLabel}
+)
+
+// claim is a number the answer states on one of its lines.
+type claim struct {
+	line  int
+	value float64
+	text  string
+}
+
+// fix is a wrong claim and the value it should have.
+type fix struct {
+	claim
+	want float64
+}
+
+// parseFinancing finds the labeled numbers of a financing answer.
+func parseFinancing(answer string) (map[*regexp.Regexp]claim, int) {
+	claims := make(map[*regexp.Regexp]claim)
+	years := 0
+	for i, line := range strings.Split(answer, "\n") {
+		if loc := termLabel.FindStringIndex(line); loc != nil && years == 0 {
+			rest := line[loc[1]:]
+			if m := termYearsRe.FindStringSubmatch(rest); m != nil {
+				years, _ = strconv.Atoi(m[1])
+			} else if m := termMonthsRe.FindStringSubmatch(rest); m != nil {
+				months, _ := strconv.Atoi(m[1])
+				years = months / 12
+			}
+			continue
+		}
+		for _, label := range financingLines {
+			loc := label.FindStringIndex(line)
+			if loc == nil {
+				continue
+			}
+			if _, seen := claims[label]; seen {
+				break
+			}
+			if value, text, ok := grounding.Amount(line[loc[1]:]); ok {
+				claims[label] = claim{line: i, value: value, text: text}
+			}
+			break
+		}
+	}
+	return claims, years
+}
+
+// Terms returns the price, down payment and term in years (0 when not
+// stated) of a financing answer. ok is false when it states no down payment,
+// e.g. when the answer asks the user for one.
+func Terms(answer string) (price, downPayment float64, years int, ok bool) {
+	claims, years := parseFinancing(answer)
+	down, ok := claims[downLabel]
+	if !ok {
+		return 0, 0, 0, false
+	}
+	return claims[priceLabel].value, down.value, years, true
+}
+
+// checkFinancing recalculates a financing answer from its price, down
+// payment and term, at the rate of the user's credit profile. Answers without a down payment, or without a financed
+// amount or monthly payment, are questions back to the user and skipped.
+func checkFinancing(c *Checker, answer string, facts Facts) (result, bool) {
+	claims, years := parseFinancing(answer)
+	down, ok := claims[downLabel]
+	if !ok {
+		return result{}, false
+	}
+	_, hasFinanced := claims[financedLabel]
+	_, hasMonthly := claims[monthlyLabel]
+	if !hasFinanced && !hasMonthly {
+		return result{}, false
+	}
+
+	var price float64
+	if p, ok := claims[priceLabel]; ok {
+		price = p.value
+	} else if len(facts.Recent) > 0 {
+		price = facts.Recent[0].Price
+	} else {
+		return result{}, false
+	}
+	p, err := c.calc.SimulateProfile(facts.Profile, price, down.value, years)
+	if err != nil {
+		// Invalid down payments and terms are answered by the prompt rules.
+		return result{}, false
+	}
+
+	expected := map[*regexp.Regexp]float64{
+		financedLabel:  p.Financed,
+		monthlyLabel:   p.MonthlyPayment,
+		insuranceLabel: p.MonthlyInsurance,
+		totalLabel:     p.TotalPaid,
+		interestLabel:  p.TotalInterest,
+	}
+	names := map[*regexp.Regexp]string{
+		financedLabel:  "importe financiado",
+		monthlyLabel:   "pago mensual",
+		insuranceLabel: "seguro mensual",
+		totalLabel:     "total pagado",
+		interestLabel:  "total intereses",
+	}
+	var res result
+	fixes := make(map[int]fix)
+	for _, label := range []*regexp.Regexp{financedLabel, monthlyLabel, insuranceLabel, totalLabel, interestLabel} {
+		cl, ok := claims[label]
+		if !ok || c.within(cl.value, expected[label]) {
+			continue
+		}
+		res.problems = append(res.problems, fmt.Sprintf("%s %s, debería ser %s",
+			names[label], cl.text, i18n.NoteAmount(expected[label])))
+		fixes[cl.line] = fix{claim: cl, want: expected[label]}
+	}
+	if len(res.problems) == 0 {
+		return res, true
+	}
+
+	res.note = "Tu cálculo de financiamiento tenía errores. Repite la respuesta con el mismo formato usando exactamente estos valores:\n" + PlanLines(p)
+	res.rewrite = func(answer string, lang i18n.Lang) string {
+		lines := strings.Split(answer, "\n")
+		for i, f := range fixes {
+			if i < len(lines) {
+				lines[i] = strings.Replace(lines[i], f.text, i18n.FormatNumber(lang, f.want, 2), 1)
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	return res, true
+}
+
+// PlanLines lists the values of a plan for notes to the model, one
+// "- Label: value" line each, with the labels the financing answers use.
+func PlanLines(p financing.Plan) string {
+	rate := i18n.FormatNumber(i18n.Spanish, p.AnnualRate*100, 2) + "%"
+	if p.Tier != "" {
+		rate += " (nivel " + p.Tier + ")"
+	}
+	return fmt.Sprintf("- Precio: %s MXN\n- Enganche: %s MXN\n- Importe financiado: %s MXN\n"+
+		"- Tasa anual: %s\n- Plazo: %d años (%d meses)\n"+
+		"- Pago mensual (capital, intereses e IVA): %s MXN\n- Seguro mensual: %s MXN\n"+
+		"- Comisión por apertura: %s MXN\n- Total pagado: %s MXN\n- Total intereses: %s MXN\n"+
+		"- CAT: %s%% sin IVA",
+		i18n.NoteAmount(p.Price), i18n.NoteAmount(p.DownPayment), i18n.NoteAmount(p.Financed), rate, p.Years, p.Months,
+		i18n.NoteAmount(p.MonthlyPayment), i18n.NoteAmount(p.MonthlyInsurance), i18n.NoteAmount(p.OpeningCommission),
+		i18n.NoteAmount(p.TotalPaid), i18n.NoteAmount(p.TotalInterest), i18n.FormatNumber(i18n.Spanish, p.CAT*100, 2))
+}
@@ -0,0 +1,61 @@
+package customer
+
+import (
+	"context"
+	"time"
+)
+
+// MaxRemembered is how many makes or body types a profile keeps, the most
+// recent last.
+const MaxRemembered = 3
+
+// Profile is what a customer told the bot about what they look for,
+// remembered across sessions.
+type Profile struct {
+	// Budget is the most the customer wants to pay for a car.
+	Budget        float64  `json:"budget,omitempty"`
+	MonthlyBudget float64  `json:"monthly_budget,omitempty"`
+	Makes         []string `json:"makes,omitempty"`
+	BodyTypes     []string `json:"body_types,omitempty"`
+	FamilySize    int      `json:"family_size,omitempty"`
+	City          string   `json:"city,omitempty"`
+	// Financing is true once the customer asked about financing.
+	Financing bool      `json:"financing_interest,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Empty reports whether the profile holds no preference.
+func (p Profile) Empty() bool {
+	return p.Budget == 0 && p.MonthlyBudget == 0 && len(p.Makes) == 0 && len(p.BodyTypes) == 0 &&
+		p.FamilySize == 0 && p.City == "" && !p.Financing
+}
+
+// remember adds v to the end of list, moving it there if it was already in,
+// and keeps the last MaxRemembered.
+func remember(list []string, v string) []string {
+	out := make([]string, 0, len(list)+1)
+	for _, x := range list {
+		if x != v {
+			out = append(out, x)
+		}
+	}
+	out = append(out, v)
+	if len(out) > MaxRemembered {
+		out = out[len(out)-MaxRemembered:]
+	}
+	return out
+}
+
+type idKey struct{}
+
+// WithID marks ctx as a request of the customer id: the WhatsApp number or
+// the identity cookie of the web.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// ID returns the customer of ctx, or "" when it's unknown.
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
@@ -0,0 +1,130 @@
+package customer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/financing"
+)
+
+// minBudget is the smallest amount taken as the price of a car; smaller
+// amounts are monthly payments, mileages or other numbers.
+const minBudget = 50000
+
+var (
+	budgetRe       = regexp.MustCompile(`\b(?:presupuesto(?: es)?(?: de)?|hasta|menos de|maximo|no mas de|budget(?: is| of)?|up to|under|less than|orcamento(?: e)?(?: de)?|ate)\s*\$?\s*(\d{1,3}(?:[,.]\d{3})+|\d+)\s*(?:(mil|k)\b)?`)
+	notBudgetRe    = regexp.MustCompile(`^\s*(?:pesos|mxn)?\s*(?:km|kms|kilometros|kilometers|quilometros|al mes|por mes|mensual|a month|per month|monthly|por mes|mensais)\b`)
+	familyRe       = regexp.MustCompile(`\b(?:somos|familia de|family of|we are|we're|somos em)\s+(\d+|dos|tres|cuatro|cinco|seis|siete|ocho|two|three|four|five|six|seven|eight|duas|quatro|sete|oito)\b`)
+	cityRe         = regexp.MustCompile(`\b(?:vivo en|soy de|radico en|i live in|i'm from|i am from|moro em|moro no|moro na|sou de)\s+(\p{L}[\p{L} ]{1,40})`)
+	cityStopRe     = regexp.MustCompile(`\s+(?:y|pero|and|but|e|mas|busco|quiero|tengo)\b.*$`)
+	accents        = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ñ", "n", "ã", "a", "õ", "o", "ç", "c", "ê", "e", "ô", "o")
+	cityConnectors = map[string]bool{"de": true, "del": true, "la": true, "do": true, "da": true, "dos": true, "das": true}
+	numbers        = map[string]int{
+		"dos": 2, "tres": 3, "cuatro": 4, "cinco": 5, "seis": 6, "siete": 7, "ocho": 8,
+		"two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7, "eight": 8,
+		"duas": 2, "quatro": 4, "sete": 7, "oito": 8,
+	}
+	bodyTypes = []struct {
+		name string
+		re   *regexp.Regexp
+	}{
+		{"SUV", regexp.MustCompile(`\b(suvs?|camionetas?)\b`)},
+		{"sedán", regexp.MustCompile(`\b(sedan(es|s)?)\b`)},
+		{"hatchback", regexp.MustCompile(`\b(hatchbacks?|hatch)\b`)},
+		{"pickup", regexp.MustCompile(`\b(pick ?-?ups?)\b`)},
+		{"minivan", regexp.MustCompile(`\b(minivans?)\b`)},
+		{"coupé", regexp.MustCompile(`\b(coupes?|deportiv[oa]s?|sports? cars?|esportiv[oa]s?)\b`)},
+	}
+)
+
+// Extractor reads a customer's preferences from their messages. Makes are
+// the ones in the catalog.
+type Extractor struct {
+	cat *catalog.Catalog
+}
+
+func NewExtractor(cat *catalog.Catalog) *Extractor {
+	return &Extractor{cat: cat}
+}
+
+// Extract returns p updated with the preferences text states, and whether
+// it states any. Newer values replace older ones; makes and body types are
+// added to the ones remembered.
+func (x *Extractor) Extract(text string, p Profile) (Profile, bool) {
+	lower := strings.ToLower(text)
+	t := accents.Replace(lower)
+	changed := false
+
+	if budget := parseBudget(t); budget > 0 && budget != p.Budget {
+		p.Budget, changed = budget, true
+	}
+	if monthly := financing.ParseTerms(text).MonthlyBudget; monthly > 0 && monthly != p.MonthlyBudget {
+		p.MonthlyBudget, changed = monthly, true
+	}
+	if mk := x.cat.ParseFilter(text).Make; mk != "" {
+		p.Makes, changed = remember(p.Makes, mk), true
+	}
+	for _, bt := range bodyTypes {
+		if bt.re.MatchString(t) {
+			p.BodyTypes, changed = remember(p.BodyTypes, bt.name), true
+		}
+	}
+	if m := familyRe.FindStringSubmatch(t); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			n = numbers[m[1]]
+		}
+		if n >= 1 && n <= 12 && n != p.FamilySize {
+			p.FamilySize, changed = n, true
+		}
+	}
+	if m := cityRe.FindStringSubmatch(lower); m != nil {
+		if city := cityName(m[1]); city != "" && city != p.City {
+			p.City, changed = city, true
+		}
+	}
+	return p, changed
+}
+
+// parseBudget returns the car budget in t, or 0 when t has none.
+func parseBudget(t string) float64 {
+	for _, idx := range budgetRe.FindAllStringSubmatchIndex(t, -1) {
+		if notBudgetRe.MatchString(t[idx[1]:]) {
+			continue
+		}
+		amount, _ := strconv.ParseFloat(strings.NewReplacer(",", "", ".", "").Replace(t[idx[2]:idx[3]]), 64)
+		if idx[4] >= 0 {
+			amount *= 1000
+		}
+		if amount >= minBudget {
+			return amount
+		}
+	}
+	return 0
+}
+
+// cityName keeps the first words of a place, up to a connector, with
+// capitals.
+func cityName(s string) string {
+	s = strings.TrimSpace(cityStopRe.ReplaceAllString(s, ""))
+	words := strings.Fields(s)
+	if len(words) > 0 && (words[0] == "la" || words[0] == "el") {
+		words = words[1:]
+	}
+	if len(words) > 4 {
+		words = words[:4]
+	}
+	for len(words) > 0 && cityConnectors[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	for i, w := range words {
+		if i > 0 && cityConnectors[w] {
+			continue
+		}
+		r := []rune(w)
+		words[i] = strings.ToUpper(string(r[0])) + string(r[1:])
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,123 @@
+package experiments
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+)
+
+// Variant is the set of settings a session runs with.
+type Variant struct {
+	Name          string `json:"name"`
+	Weight        int    `json:"weight"`
+	PromptVersion string `json:"prompt_version"`
+	Model         string `json:"model"`
+	TopN          int    `json:"top_n"`
+}
+
+// Stats are the volumes seen by one variant since startup.
+type Stats struct {
+	Variant
+	Sessions int `json:"sessions"`
+	Turns    int `json:"turns"`
+}
+
+// Experiment buckets sessions into weighted variants. The bucket depends only
+// on the experiment name and the session ID, so a session keeps its variant
+// across requests and replicas.
+type Experiment struct {
+	name     string
+	variants []Variant
+	total    uint32
+
+	mu       sync.Mutex
+	sessions map[string]int
+	turns    map[string]int
+}
+
+// New builds the experiment in cfg. Variants inherit any unset setting from
+// defaults; without configured variants every session gets defaults under the
+// name "control".
+func New(cfg config.ExperimentConfig, defaults Variant) *Experiment {
+	e := &Experiment{
+		name:     cfg.Name,
+		sessions: make(map[string]int),
+		turns:    make(map[string]int),
+	}
+
+	for _, vc := range cfg.Variants {
+		if vc.Weight <= 0 {
+			continue
+		}
+		v := defaults
+		v.Name = vc.Name
+		v.Weight = vc.Weight
+		if vc.PromptVersion != "" {
+			v.PromptVersion = vc.PromptVersion
+		}
+		if vc.Model != "" {
+			v.Model = vc.Model
+		}
+		if vc.TopN > 0 {
+			v.TopN = vc.TopN
+		}
+		e.variants = append(e.variants, v)
+		e.total += uint32(v.Weight)
+	}
+
+	if len(e.variants) == 0 {
+		defaults.Name = "control"
+		defaults.Weight = 1
+		e.variants = []Variant{defaults}
+		e.total = 1
+	}
+	return e
+}
+
+func (e *Experiment) Name() string {
+	return e.name
+}
+
+// Assign returns the variant of sessionID.
+func (e *Experiment) Assign(sessionID string) Variant {
+	h := fnv.New32a()
+	h.Write([]byte(e.name + ":" + sessionID))
+	bucket := h.Sum32() % e.total
+
+	for _, v := range e.variants {
+		if bucket < uint32(v.Weight) {
+			return v
+		}
+		bucket -= uint32(v.Weight)
+	}
+	return e.variants[len(e.variants)-1]
+}
+
+func (e *Experiment) RecordSession(v Variant) {
+	e.mu.Lock()
+	e.sessions[v.Name]++
+	e.mu.Unlock()
+	metrics.ExperimentSessions.WithLabelValues(e.name, v.Name).Inc()
+}
+
+func (e *Experiment) RecordTurn(v Variant) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.turns[v.Name]++
+}
+
+func (e *Experiment) Stats() []Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	stats := make([]Stats, 0, len(e.variants))
+	for _, v := range e.variants {
+		stats = append(stats, Stats{
+			Variant:  v,
+			Sessions: e.sessions[v.Name],
+			Turns:    e.turns[v.Name],
+		})
+	}
+	return stats
+}
@@ -0,0 +1,306 @@
+package financing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+)
+
+var (
+	ErrInvalidPrice        = errors.New("price must be greater than zero")
+	ErrNegativeDownPayment = errors.New("down payment can't be negative")
+	ErrDownPaymentTooHigh  = errors.New("down payment must be lower than the price")
+	ErrDownPaymentTooLow   = errors.New("down payment is below the minimum")
+	ErrTermOutOfRange      = errors.New("term is out of range")
+	ErrInvalidBudget       = errors.New("monthly budget must be greater than zero")
+)
+
+// Plan is a car loan with fixed monthly payments (French amortization).
+// Amounts are rounded to cents; the last payment absorbs the rounding.
+type Plan struct {
+	Price       float64 `json:"price"`
+	DownPayment float64 `json:"down_payment"`
+	Financed    float64 `json:"financed"`
+	Profile     Profile `json:"profile,omitempty"`
+	// Tier is the rate tier that applied; empty for the base rate.
+	Tier       string  `json:"tier,omitempty"`
+	AnnualRate float64 `json:"annual_rate"`
+	IVA        float64 `json:"iva"`
+	Years      int     `json:"years"`
+	Months     int     `json:"months"`
+	// MonthlyPayment covers principal, interest and the IVA on interest.
+	MonthlyPayment float64 `json:"monthly_payment"`
+	// MonthlyInsurance is paid on top of MonthlyPayment.
+	MonthlyInsurance float64 `json:"monthly_insurance"`
+	// OpeningCommission is paid once, when the loan is opened.
+	OpeningCommission float64 `json:"opening_commission"`
+	TotalInterest     float64 `json:"total_interest"`
+	TotalIVA          float64 `json:"total_iva"`
+	TotalInsurance    float64 `json:"total_insurance"`
+	// TotalPaid is everything paid after the down payment: installments,
+	// insurance and the opening commission.
+	TotalPaid float64 `json:"total_paid"`
+	// CAT is the Costo Anual Total, without IVA as Banxico requires for
+	// disclosure, as a fraction (0.215 is 21.5%).
+	CAT float64 `json:"cat"`
+}
+
+// MonthlyTotal is what the customer pays each month.
+func (p Plan) MonthlyTotal() float64 {
+	return round(p.MonthlyPayment + p.MonthlyInsurance)
+}
+
+// Calculator simulates plans under the configured rates and rules.
+type Calculator struct {
+	cfg config.FinancingConfig
+}
+
+func New(cfg config.FinancingConfig) *Calculator {
+	if cfg.MinYears <= 0 {
+		cfg.MinYears = 1
+	}
+	if cfg.MaxYears < cfg.MinYears {
+		cfg.MaxYears = cfg.MinYears
+	}
+	if cfg.DefaultYears < cfg.MinYears || cfg.DefaultYears > cfg.MaxYears {
+		cfg.DefaultYears = cfg.MinYears
+	}
+	return &Calculator{cfg: cfg}
+}
+
+// Config returns the rates and rules in use, with defaults applied.
+func (c *Calculator) Config() config.FinancingConfig {
+	return c.cfg
+}
+
+// Validate checks a down payment and term against the rules. years 0 means
+// the default term.
+func (c *Calculator) Validate(price, downPayment float64, years int) error {
+	if price <= 0 {
+		return ErrInvalidPrice
+	}
+	if downPayment < 0 {
+		return ErrNegativeDownPayment
+	}
+	if downPayment >= price {
+		return ErrDownPaymentTooHigh
+	}
+	if min := round(price * c.cfg.MinDownPayment); downPayment < min {
+		return fmt.Errorf("%w: %.2f, at least %.2f", ErrDownPaymentTooLow, downPayment, min)
+	}
+	if years != 0 && (years < c.cfg.MinYears || years > c.cfg.MaxYears) {
+		return fmt.Errorf("%w: %d years, allowed %d to %d", ErrTermOutOfRange, years, c.cfg.MinYears, c.cfg.MaxYears)
+	}
+	return nil
+}
+
+// Simulate returns the plan for a customer who didn't declare a credit
+// profile.
+func (c *Calculator) Simulate(price, downPayment float64, years int) (Plan, error) {
+	return c.SimulateProfile(Unknown, price, downPayment, years)
+}
+
+// Example is Simulate for worked examples: a down payment below the minimum
+// is raised to it and a term out of range is moved to the nearest allowed
+// one, so the example still renders under stricter rules. It fails only
+// when the rules allow no plan for price at all.
+func (c *Calculator) Example(price, downPayment float64, years int) (Plan, error) {
+	if least := round(price * c.cfg.MinDownPayment); downPayment < least {
+		downPayment = least
+	}
+	if years != 0 {
+		years = max(c.cfg.MinYears, min(years, c.cfg.MaxYears))
+	}
+	return c.Simulate(price, downPayment, years)
+}
+
+// SimulateProfile returns the plan for financing price minus downPayment
+// over years, or the default term when years is 0, at the rate of the tier
+// that matches profile.
+func (c *Calculator) SimulateProfile(profile Profile, price, downPayment float64, years int) (Plan, error) {
+	if err := c.Validate(price, downPayment, years); err != nil {
+		return Plan{}, err
+	}
+	if years == 0 {
+		years = c.cfg.DefaultYears
+	}
+
+	p := Plan{
+		Price:       round(price),
+		DownPayment: round(downPayment),
+		Profile:     profile,
+		IVA:         c.cfg.IVA,
+		Years:       years,
+		Months:      years * 12,
+	}
+	p.Financed = round(p.Price - p.DownPayment)
+	p.Tier, p.AnnualRate = c.rate(profile, p.DownPayment/p.Price, years)
+	p.MonthlyPayment = round(Payment(p.Financed, p.AnnualRate*(1+p.IVA), p.Months))
+	p.MonthlyInsurance = round(p.Price * c.cfg.InsuranceRate / 12)
+	p.OpeningCommission = round(p.Financed * c.cfg.OpeningCommission)
+
+	var installments float64
+	for _, in := range Schedule(p) {
+		installments += in.Payment
+		p.TotalInterest += in.Interest
+		p.TotalIVA += in.IVA
+	}
+	p.TotalInterest = round(p.TotalInterest)
+	p.TotalIVA = round(p.TotalIVA)
+	p.TotalInsurance = round(p.MonthlyInsurance * float64(p.Months))
+	p.TotalPaid = round(installments + p.TotalInsurance + p.OpeningCommission)
+	p.CAT = cat(p)
+	return p, nil
+}
+
+// MaxPrice is the highest car price whose plan, with downPayment over years
+// (0 for the default term), costs at most monthlyBudget a month including
+// insurance. It's downPayment itself when no financed car fits the budget.
+func (c *Calculator) MaxPrice(profile Profile, monthlyBudget, downPayment float64, years int) (float64, error) {
+	if monthlyBudget <= 0 {
+		return 0, ErrInvalidBudget
+	}
+	if downPayment < 0 {
+		return 0, ErrNegativeDownPayment
+	}
+	if years == 0 {
+		years = c.cfg.DefaultYears
+	}
+	if years < c.cfg.MinYears || years > c.cfg.MaxYears {
+		return 0, fmt.Errorf("%w: %d years, allowed %d to %d", ErrTermOutOfRange, years, c.cfg.MinYears, c.cfg.MaxYears)
+	}
+	fits := func(price float64) bool {
+		p, err := c.SimulateProfile(profile, price, downPayment, years)
+		return err == nil && p.MonthlyTotal() <= monthlyBudget
+	}
+
+	// With tiers ordered from best to worst, payments never fall as the price
+	// grows, so the affordable prices are an interval starting at the down
+	// payment; bisect its end.
+	// Without interest the budget would finance budget × months at most.
+	lo, hi := downPayment, downPayment+monthlyBudget*float64(years*12)
+	if !fits(lo + 1) {
+		return round(downPayment), nil
+	}
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return math.Floor(lo), nil
+}
+
+// rate returns the first tier matching the profile, down payment fraction
+// and term, or the base rate.
+func (c *Calculator) rate(profile Profile, downFraction float64, years int) (string, float64) {
+	for _, t := range c.cfg.Tiers {
+		if t.Profile != "" && Profile(t.Profile) != profile {
+			continue
+		}
+		if downFraction+1e-9 < t.MinDownPayment {
+			continue
+		}
+		if t.MaxYears > 0 && years > t.MaxYears {
+			continue
+		}
+		return t.Name, t.AnnualRate
+	}
+	return "", c.cfg.AnnualRate
+}
+
+// Payment is the unrounded fixed monthly payment that repays financed in
+// months at annualRate, compounded monthly.
+func Payment(financed, annualRate float64, months int) float64 {
+	if months <= 0 {
+		return 0
+	}
+	r := annualRate / 12
+	if r == 0 {
+		return financed / float64(months)
+	}
+	return r * financed / (1 - math.Pow(1+r, -float64(months)))
+}
+
+// Installment is one month of an amortization table. Payment is Principal
+// plus Interest plus IVA; Insurance is paid on top.
+type Installment struct {
+	Month     int     `json:"month"`
+	Payment   float64 `json:"payment"`
+	Principal float64 `json:"principal"`
+	Interest  float64 `json:"interest"`
+	IVA       float64 `json:"iva"`
+	Insurance float64 `json:"insurance"`
+	Balance   float64 `json:"balance"`
+}
+
+// Schedule splits each payment of p into principal, interest and IVA.
+// Interest is rounded to cents every month and the last payment settles the
+// balance.
+func Schedule(p Plan) []Installment {
+	r := p.AnnualRate / 12
+	table := make([]Installment, 0, p.Months)
+	balance := p.Financed
+	for month := 1; month <= p.Months; month++ {
+		interest := round(balance * r)
+		iva := round(interest * p.IVA)
+		payment := p.MonthlyPayment
+		principal := round(payment - interest - iva)
+		if month == p.Months || principal > balance {
+			principal = balance
+			payment = round(principal + interest + iva)
+		}
+		balance = round(balance - principal)
+		table = append(table, Installment{
+			Month:     month,
+			Payment:   payment,
+			Principal: principal,
+			Interest:  interest,
+			IVA:       iva,
+			Insurance: p.MonthlyInsurance,
+			Balance:   balance,
+		})
+	}
+	return table
+}
+
+// cat solves for the yearly rate that makes the payments, without IVA,
+// worth the amount actually received (financed minus the opening
+// commission), following Banxico's CAT methodology.
+func cat(p Plan) float64 {
+	received := p.Financed - p.OpeningCommission
+	if received <= 0 || p.Months == 0 {
+		return 0
+	}
+	flows := make([]float64, 0, p.Months)
+	for _, in := range Schedule(p) {
+		flows = append(flows, in.Payment-in.IVA+in.Insurance)
+	}
+	presentValue := func(yearly float64) float64 {
+		var pv float64
+		for k, f := range flows {
+			pv += f / math.Pow(1+yearly, float64(k+1)/12)
+		}
+		return pv
+	}
+
+	// The present value falls as the rate grows; bisect until it matches.
+	lo, hi := 0.0, 10.0
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if presentValue(mid) > received {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return math.Round((lo+hi)/2*10000) / 10000
+}
+
+func round(x float64) float64 {
+	return math.Round(x*100) / 100
+}
@@ -0,0 +1,196 @@
+package financing
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+)
+
+// plainRules charge only interest: no IVA, insurance or commission, like
+// the worked examples the original prompt had the model compute by hand.
+var plainRules = config.FinancingConfig{AnnualRate: 0.10, MinYears: 3, MaxYears: 6, DefaultYears: 5}
+
+func TestSimulateAmortization(t *testing.T) {
+	// The original prompt's examples, 10% over 5 years, with the French
+	// amortization figures; TestOriginalPromptExamples keeps the ones the
+	// prompt quoted.
+	tests := []struct {
+		name                         string
+		price, downPayment           float64
+		years                        int
+		financed                     float64
+		monthly, totalPaid, totalInt float64
+	}{
+		{"touareg", 461999, 100000, 5, 361999, 7691.41, 461484.58, 99485.58},
+		{"audi a3", 589000, 150000, 5, 439000, 9327.45, 559647.20, 120647.20},
+		{"mazda cx-5", 396999, 150000, 5, 246999, 5248.00, 314879.91, 67880.91},
+	}
+	calc := New(plainRules)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := calc.Simulate(tt.price, tt.downPayment, tt.years)
+			if err != nil {
+				t.Fatalf("Simulate: %v", err)
+			}
+			if p.Financed != tt.financed || p.Months != tt.years*12 {
+				t.Errorf("financed %.2f over %d months, want %.2f over %d", p.Financed, p.Months, tt.financed, tt.years*12)
+			}
+			if p.MonthlyPayment != tt.monthly {
+				t.Errorf("monthly payment %.2f, want %.2f", p.MonthlyPayment, tt.monthly)
+			}
+			if p.TotalPaid != tt.totalPaid {
+				t.Errorf("total paid %.2f, want %.2f", p.TotalPaid, tt.totalPaid)
+			}
+			if p.TotalInterest != tt.totalInt {
+				t.Errorf("total interest %.2f, want %.2f", p.TotalInterest, tt.totalInt)
+			}
+			if got := round(p.TotalPaid - p.Financed); got != p.TotalInterest {
+				t.Errorf("total paid minus financed is %.2f, interest is %.2f", got, p.TotalInterest)
+			}
+		})
+	}
+}
+
+// TestOriginalPromptExamples checks the calculator against the worked
+// examples the system prompt had before they were rendered from it. Those
+// were computed by hand and are off: 7,623.45 is the payment of 361,999 at
+// 9.62% a year, not 10% (7,691.41), and 9,333.58 the one of 439,000 at
+// 10.03% (9,327.45). Their totals follow from the payments. The calculator
+// must stay within 1% of them, the size of those slips; a wider gap means
+// the method changed, not the arithmetic.
+func TestOriginalPromptExamples(t *testing.T) {
+	tests := []struct {
+		name                         string
+		price, downPayment           float64
+		monthly, totalPaid, totalInt float64
+	}{
+		{"touareg", 461999, 100000, 7623.45, 457407, 95408},
+		{"audi a3", 589000, 150000, 9333.58, 560015, 121015},
+	}
+	calc := New(plainRules)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := calc.Simulate(tt.price, tt.downPayment, 5)
+			if err != nil {
+				t.Fatalf("Simulate: %v", err)
+			}
+			if math.Round(tt.monthly*60) != tt.totalPaid || tt.totalPaid-p.Financed != tt.totalInt {
+				t.Fatalf("the quoted example isn't consistent with %.2f financed over 60 months", p.Financed)
+			}
+			for _, v := range []struct {
+				label     string
+				got, want float64
+			}{
+				{"monthly payment", p.MonthlyPayment, tt.monthly},
+				{"total paid", p.TotalPaid, tt.totalPaid},
+			} {
+				if off := math.Abs(v.got-v.want) / v.want; off > 0.01 {
+					t.Errorf("%s %.2f is %.1f%% off the prompt's %.2f", v.label, v.got, off*100, v.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPayment(t *testing.T) {
+	tests := []struct {
+		financed, rate float64
+		months         int
+		want           float64
+	}{
+		{361999, 0.10, 60, 7691.41},
+		{100000, 0.10, 12, 8791.59},
+		{120000, 0, 60, 2000},
+		{120000, 0.10, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := round(Payment(tt.financed, tt.rate, tt.months)); got != tt.want {
+			t.Errorf("Payment(%.2f, %.2f, %d) = %.2f, want %.2f", tt.financed, tt.rate, tt.months, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleSettlesBalance(t *testing.T) {
+	cfg := plainRules
+	cfg.IVA = 0.16
+	p, err := New(cfg).Simulate(461999, 100000, 5)
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	table := Schedule(p)
+	if len(table) != p.Months {
+		t.Fatalf("%d installments, want %d", len(table), p.Months)
+	}
+	var principal float64
+	for _, in := range table {
+		principal += in.Principal
+		if got := round(in.Principal + in.Interest + in.IVA); got != in.Payment {
+			t.Errorf("month %d: parts add up to %.2f, payment is %.2f", in.Month, got, in.Payment)
+		}
+	}
+	if last := table[len(table)-1]; last.Balance != 0 {
+		t.Errorf("balance after the last payment is %.2f", last.Balance)
+	}
+	if math.Abs(principal-p.Financed) > 0.005 {
+		t.Errorf("principal paid %.2f, financed %.2f", principal, p.Financed)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := plainRules
+	cfg.MinDownPayment = 0.1
+	calc := New(cfg)
+	tests := []struct {
+		name               string
+		price, downPayment float64
+		years              int
+		want               error
+	}{
+		{"valid", 461999, 100000, 5, nil},
+		{"default term", 461999, 100000, 0, nil},
+		{"minimum down payment", 100000, 10000, 3, nil},
+		{"zero price", 0, 0, 5, ErrInvalidPrice},
+		{"negative price", -1, 0, 5, ErrInvalidPrice},
+		{"negative down payment", 461999, -1, 5, ErrNegativeDownPayment},
+		{"down payment equals price", 461999, 461999, 5, ErrDownPaymentTooHigh},
+		{"down payment above price", 461999, 500000, 5, ErrDownPaymentTooHigh},
+		{"down payment below minimum", 100000, 9999, 5, ErrDownPaymentTooLow},
+		{"term too short", 461999, 100000, 2, ErrTermOutOfRange},
+		{"term too long", 461999, 100000, 7, ErrTermOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := calc.Validate(tt.price, tt.downPayment, tt.years)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Validate(%.2f, %.2f, %d) = %v, want %v", tt.price, tt.downPayment, tt.years, err, tt.want)
+			}
+			if _, simErr := calc.Simulate(tt.price, tt.downPayment, tt.years); !errors.Is(simErr, tt.want) {
+				t.Errorf("Simulate error %v, want %v", simErr, tt.want)
+			}
+		})
+	}
+}
+
+func TestExample(t *testing.T) {
+	cfg := plainRules
+	cfg.MinDownPayment = 0.3
+	calc := New(cfg)
+
+	p, err := calc.Example(461999, 100000, 8)
+	if err != nil {
+		t.Fatalf("Example: %v", err)
+	}
+	if p.DownPayment != 138599.70 {
+		t.Errorf("down payment %.2f, want it raised to 138599.70", p.DownPayment)
+	}
+	if p.Years != cfg.MaxYears {
+		t.Errorf("term %d years, want it lowered to %d", p.Years, cfg.MaxYears)
+	}
+
+	cfg.MinDownPayment = 1
+	if _, err := New(cfg).Example(461999, 100000, 5); !errors.Is(err, ErrDownPaymentTooHigh) {
+		t.Errorf("Example with no valid plan = %v, want ErrDownPaymentTooHigh", err)
+	}
+}
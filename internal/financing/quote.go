@@ -0,0 +1,137 @@
+package financing
+
+import (
+	"encoding/csv"
+	"html/template"
+	"io"
+	"strconv"
+
+	"carlospayan/agent-comercial-ai/internal/i18n"
+)
+
+// Quote is a plan for a specific car with its amortization table.
+type Quote struct {
+	StockID  string        `json:"stock_id"`
+	Car      string        `json:"car"`
+	Plan     Plan          `json:"plan"`
+	Schedule []Installment `json:"schedule"`
+}
+
+func NewQuote(stockID, car string, p Plan) Quote {
+	return Quote{StockID: stockID, Car: car, Plan: p, Schedule: Schedule(p)}
+}
+
+// WriteCSV writes the amortization table with plain numbers, for
+// spreadsheets.
+func (q Quote) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"month", "payment", "principal", "interest", "iva", "insurance", "balance"})
+	for _, in := range q.Schedule {
+		cw.Write([]string{
+			strconv.Itoa(in.Month),
+			strconv.FormatFloat(in.Payment, 'f', 2, 64),
+			strconv.FormatFloat(in.Principal, 'f', 2, 64),
+			strconv.FormatFloat(in.Interest, 'f', 2, 64),
+			strconv.FormatFloat(in.IVA, 'f', 2, 64),
+			strconv.FormatFloat(in.Insurance, 'f', 2, 64),
+			strconv.FormatFloat(in.Balance, 'f', 2, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var quoteLabels = map[i18n.Lang]map[string]string{
+	i18n.Spanish: {
+		"title": "Cotización de financiamiento", "price": "Precio", "down": "Enganche",
+		"financed": "Importe financiado", "rate": "Tasa anual", "term": "Plazo", "months": "meses",
+		"monthly": "Pago mensual", "total": "Total pagado", "interest": "Total intereses",
+		"insurance": "Seguro mensual", "commission": "Comisión por apertura", "iva": "IVA de intereses", "cat": "CAT sin IVA",
+		"month": "Mes", "payment": "Pago", "principal": "Capital", "interestCol": "Interés", "ivaCol": "IVA", "insuranceCol": "Seguro", "balance": "Saldo",
+		"note": "Cotización informativa; sujeta a aprobación de crédito. El CAT es para fines informativos y de comparación.",
+	},
+	i18n.English: {
+		"title": "Financing quote", "price": "Price", "down": "Down payment",
+		"financed": "Financed amount", "rate": "Annual rate", "term": "Term", "months": "months",
+		"monthly": "Monthly payment", "total": "Total paid", "interest": "Total interest",
+		"insurance": "Monthly insurance", "commission": "Opening commission", "iva": "VAT on interest", "cat": "CAT (total annual cost) before VAT",
+		"month": "Month", "payment": "Payment", "principal": "Principal", "interestCol": "Interest", "ivaCol": "VAT", "insuranceCol": "Insurance", "balance": "Balance",
+		"note": "For information only; subject to credit approval. The CAT is for information and comparison purposes.",
+	},
+	i18n.Portuguese: {
+		"title": "Cotação de financiamento", "price": "Preço", "down": "Entrada",
+		"financed": "Valor financiado", "rate": "Taxa anual", "term": "Prazo", "months": "meses",
+		"monthly": "Parcela mensal", "total": "Total pago", "interest": "Total de juros",
+		"insurance": "Seguro mensal", "commission": "Comissão de abertura", "iva": "IVA sobre juros", "cat": "CAT (custo anual total) sem IVA",
+		"month": "Mês", "payment": "Parcela", "principal": "Amortização", "interestCol": "Juros", "ivaCol": "IVA", "insuranceCol": "Seguro", "balance": "Saldo",
+		"note": "Cotação informativa; sujeita à aprovação de crédito. O CAT é para fins informativos e de comparação.",
+	},
+}
+
+var quoteHTML = template.Must(template.New("quote").Parse(`<!DOCTYPE html>
+<html lang="{{ .Lang }}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .L.title }} – {{ .Q.Car }}</title>
+<style>
+body { font-family: sans-serif; margin: 1.5rem; color: #222; }
+table { border-collapse: collapse; }
+th, td { padding: .3rem .8rem; text-align: right; border-bottom: 1px solid #ddd; }
+th:first-child, td:first-child { text-align: left; }
+dl { display: grid; grid-template-columns: max-content auto; gap: .3rem 1rem; }
+dt { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{ .L.title }}</h1>
+<h2>{{ .Q.Car }}</h2>
+<dl>
+<dt>{{ .L.price }}</dt><dd>{{ call .Money .Q.Plan.Price }}</dd>
+<dt>{{ .L.down }}</dt><dd>{{ call .Money .Q.Plan.DownPayment }}</dd>
+<dt>{{ .L.financed }}</dt><dd>{{ call .Money .Q.Plan.Financed }}</dd>
+<dt>{{ .L.rate }}</dt><dd>{{ .Rate }}</dd>
+<dt>{{ .L.term }}</dt><dd>{{ .Q.Plan.Months }} {{ .L.months }}</dd>
+<dt>{{ .L.monthly }}</dt><dd>{{ call .Money .Q.Plan.MonthlyPayment }}</dd>
+<dt>{{ .L.insurance }}</dt><dd>{{ call .Money .Q.Plan.MonthlyInsurance }}</dd>
+<dt>{{ .L.commission }}</dt><dd>{{ call .Money .Q.Plan.OpeningCommission }}</dd>
+<dt>{{ .L.total }}</dt><dd>{{ call .Money .Q.Plan.TotalPaid }}</dd>
+<dt>{{ .L.interest }}</dt><dd>{{ call .Money .Q.Plan.TotalInterest }}</dd>
+<dt>{{ .L.iva }}</dt><dd>{{ call .Money .Q.Plan.TotalIVA }}</dd>
+<dt>{{ .L.cat }}</dt><dd>{{ .CAT }}</dd>
+</dl>
+<table>
+<tr><th>{{ .L.month }}</th><th>{{ .L.payment }}</th><th>{{ .L.principal }}</th><th>{{ .L.interestCol }}</th><th>{{ .L.ivaCol }}</th><th>{{ .L.insuranceCol }}</th><th>{{ .L.balance }}</th></tr>
+{{- range .Q.Schedule }}
+<tr><td>{{ .Month }}</td><td>{{ call $.Money .Payment }}</td><td>{{ call $.Money .Principal }}</td><td>{{ call $.Money .Interest }}</td><td>{{ call $.Money .IVA }}</td><td>{{ call $.Money .Insurance }}</td><td>{{ call $.Money .Balance }}</td></tr>
+{{- end }}
+</table>
+<p><small>{{ .L.note }}</small></p>
+</body>
+</html>
+`))
+
+// WriteHTML renders the quote as a page in lang.
+func (q Quote) WriteHTML(w io.Writer, lang i18n.Lang) error {
+	labels, ok := quoteLabels[lang]
+	if !ok {
+		lang, labels = i18n.Default, quoteLabels[i18n.Default]
+	}
+	return quoteHTML.Execute(w, struct {
+		Lang  i18n.Lang
+		L     map[string]string
+		Q     Quote
+		Rate  string
+		CAT   string
+		Money func(float64) string
+	}{
+		Lang: lang,
+		L:    labels,
+		Q:    q,
+		Rate: i18n.FormatNumber(lang, q.Plan.AnnualRate*100, 2) + "%",
+		CAT:  i18n.FormatNumber(lang, q.Plan.CAT*100, 2) + "%",
+		Money: func(amount float64) string {
+			return i18n.FormatMXN(lang, amount)
+		},
+	})
+}
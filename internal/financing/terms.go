@@ -0,0 +1,140 @@
+package financing
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Profile is the credit profile a customer declares about themselves.
+type Profile string
+
+const (
+	Unknown   Profile = ""
+	Excellent Profile = "excellent"
+	Good      Profile = "good"
+	Fair      Profile = "fair"
+	Limited   Profile = "limited"
+)
+
+func ParseProfile(s string) (Profile, bool) {
+	switch p := Profile(strings.ToLower(strings.TrimSpace(s))); p {
+	case Unknown, Excellent, Good, Fair, Limited:
+		return p, true
+	}
+	return Unknown, false
+}
+
+// Terms are the financing conditions a customer states in a message. Zero
+// values mean the message didn't mention them.
+type Terms struct {
+	DownPayment float64 `json:"down_payment,omitempty"`
+	Years       int     `json:"years,omitempty"`
+	Profile     Profile `json:"profile,omitempty"`
+	// MonthlyBudget is how much the customer can pay each month.
+	MonthlyBudget float64 `json:"monthly_budget,omitempty"`
+	// TradeIn is the offer for the customer's car, which goes to the down
+	// payment on top of DownPayment.
+	TradeIn float64 `json:"trade_in,omitempty"`
+}
+
+// TotalDownPayment is the cash down payment plus the trade-in offer.
+func (t Terms) TotalDownPayment() float64 {
+	return t.DownPayment + t.TradeIn
+}
+
+// Merge returns t with the conditions mentioned in newer replacing its own.
+func (t Terms) Merge(newer Terms) Terms {
+	if newer.DownPayment > 0 {
+		t.DownPayment = newer.DownPayment
+	}
+	if newer.Years > 0 {
+		t.Years = newer.Years
+	}
+	if newer.Profile != Unknown {
+		t.Profile = newer.Profile
+	}
+	if newer.MonthlyBudget > 0 {
+		t.MonthlyBudget = newer.MonthlyBudget
+	}
+	if newer.TradeIn > 0 {
+		t.TradeIn = newer.TradeIn
+	}
+	return t
+}
+
+var (
+	termAmountRe = regexp.MustCompile(`\$?\s?(\d{1,3}(?:[,.]\d{3})+|\d+)(?:[.,]\d{1,2})?\s*(mil\b|k\b)?`)
+	termYearsRe  = regexp.MustCompile(`(\d+)\s*(anos|years?)\b`)
+	termMonthsRe = regexp.MustCompile(`(\d+)\s*(meses|months?)\b`)
+	termUnitRe   = regexp.MustCompile(`^\s*(anos|years?|meses|months?|%)`)
+	perMonthRe   = regexp.MustCompile(`^\s*(pesos\s*|mxn\s*|reais\s*)?(al mes|por mes|mensuales|de mensualidad|a month|per month|monthly|mensais)\b`)
+	downCueRe    = regexp.MustCompile(`^\s*(pesos\s*|mxn\s*|reais\s*)?(de enganche|de entrada|down)\b`)
+	downOfRe     = regexp.MustCompile(`\b(enganche|down payment|entrada)( de| of)?\s*$`)
+	modelYearRe  = regexp.MustCompile(`^\s?(19[89]\d|20[0-4]\d)$`)
+	monthlyOfRe  = regexp.MustCompile(`\b(mensualidad(es)?|pago mensual|monthly (payment|budget)|parcelas?)( de| of)?\s*$`)
+	profileWords = []struct {
+		profile Profile
+		re      *regexp.Regexp
+	}{
+		// Negative phrasings first: "no tengo buen historial" is limited.
+		{Limited, regexp.MustCompile(`\b(mal(o)? (historial|credito|buro)|(historial|credito|buro)( es| esta)? (malo|negativo)|no tengo (buen )?(historial|credito)|sin (historial|credito)|bad credit|no credit|poor credit|nome sujo|sem historico)\b`)},
+		{Excellent, regexp.MustCompile(`\b((historial|credito|buro)( es| esta)? (excelente|impecable|muy bueno)|excelente (historial|credito)|excellent credit|great credit|credito excelente)\b`)},
+		{Fair, regexp.MustCompile(`\b((historial|credito|buro)( es| esta)? (regular|mas o menos)|fair credit|average credit|credito regular)\b`)},
+		{Good, regexp.MustCompile(`\b((historial|credito|buro)( es| esta)? (bueno|limpio)|buen (historial|credito)|good credit|nome limpo|credito bom)\b`)},
+	}
+	accents = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ñ", "n", "ã", "a", "õ", "o", "ç", "c", "ê", "e", "ô", "o")
+)
+
+// ParseTerms reads the down payment, term, credit profile and monthly budget
+// from a message such as "te doy 100 mil de enganche a 4 años, mi historial
+// es bueno". The monthly budget is the first amount said to be per month
+// ("6,000 al mes", "mensualidades de 6,000"); the down payment is the amount
+// said to be the down payment or else the first other amount of at least
+// 1,000 that isn't a term or a model year.
+func ParseTerms(text string) Terms {
+	t := accents.Replace(strings.ToLower(text))
+	var terms Terms
+
+	if m := termYearsRe.FindStringSubmatch(t); m != nil {
+		terms.Years, _ = strconv.Atoi(m[1])
+	} else if m := termMonthsRe.FindStringSubmatch(t); m != nil {
+		months, _ := strconv.Atoi(m[1])
+		if months%12 == 0 {
+			terms.Years = months / 12
+		}
+	}
+
+	downCued := false
+	for _, loc := range termAmountRe.FindAllStringSubmatchIndex(t, -1) {
+		if termUnitRe.MatchString(t[loc[1]:]) {
+			continue
+		}
+		digits := strings.NewReplacer(",", "", ".", "").Replace(t[loc[2]:loc[3]])
+		amount, err := strconv.ParseFloat(digits, 64)
+		if err != nil {
+			continue
+		}
+		if loc[4] >= 0 {
+			amount *= 1000
+		}
+		switch {
+		case perMonthRe.MatchString(t[loc[1]:]) || monthlyOfRe.MatchString(t[:loc[0]]):
+			if terms.MonthlyBudget == 0 {
+				terms.MonthlyBudget = amount
+			}
+		case !downCued && (downCueRe.MatchString(t[loc[1]:]) || downOfRe.MatchString(t[:loc[0]])):
+			terms.DownPayment, downCued = amount, true
+		case amount >= 1000 && terms.DownPayment == 0 && !modelYearRe.MatchString(t[loc[0]:loc[1]]):
+			terms.DownPayment = amount
+		}
+	}
+
+	for _, w := range profileWords {
+		if w.re.MatchString(t) {
+			terms.Profile = w.profile
+			break
+		}
+	}
+	return terms
+}
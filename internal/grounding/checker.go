@@ -0,0 +1,89 @@
+package grounding
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+)
+
+const (
+	ActionFlag       = "flag"
+	ActionRewrite    = "rewrite"
+	ActionRegenerate = "regenerate"
+)
+
+// Checker validates answers and applies the configured action when they
+// contain violations.
+type Checker struct {
+	validator *Validator
+	action    string
+}
+
+func NewChecker(cfg config.GroundingConfig, cars []catalog.Car) *Checker {
+	action := cfg.Action
+	if action == "" {
+		action = ActionFlag
+	}
+	return &Checker{
+		validator: NewValidator(cars),
+		action:    action,
+	}
+}
+
+// Apply returns the answer to send to the user. With the regenerate action,
+// regenerate is called once with a note describing the problems; if the new
+// answer still has violations it's rewritten.
+func (c *Checker) Apply(ctx context.Context, sessionID, answer string, recent []catalog.Car, regenerate func(ctx context.Context, note string) (string, error)) string {
+	violations := c.validator.Check(answer, recent)
+	if len(violations) == 0 {
+		return answer
+	}
+	c.report(sessionID, violations)
+
+	switch c.action {
+	case ActionRewrite:
+		return Rewrite(answer, violations)
+	case ActionRegenerate:
+		regenerated, err := regenerate(ctx, Note(violations))
+		if err != nil {
+			log.Printf("grounding: session %s: regenerate failed: %v", sessionID, err)
+			return Rewrite(answer, violations)
+		}
+		again := c.validator.Check(regenerated, recent)
+		if len(again) == 0 {
+			return regenerated
+		}
+		c.report(sessionID, again)
+		return Rewrite(regenerated, again)
+	default:
+		return answer
+	}
+}
+
+func (c *Checker) report(sessionID string, violations []Violation) {
+	for _, v := range violations {
+		metrics.GroundingViolations.WithLabelValues(v.Kind, c.action).Inc()
+		log.Printf("grounding: session %s: %s", sessionID, v)
+	}
+}
+
+// Note tells the model what was wrong with its previous answer.
+func Note(violations []Violation) string {
+	var lines []string
+	for _, v := range violations {
+		switch {
+		case v.Kind == UnknownCar:
+			lines = append(lines, fmt.Sprintf("- Mencionaste un auto que no está en el catálogo: %q. No lo menciones.", v.Claim))
+		case v.Car != nil:
+			lines = append(lines, fmt.Sprintf("- El precio correcto de %s %s %s (%d) es %s MXN, no %s.",
+				v.Car.Make, v.Car.Model, v.Car.Version, v.Car.Year, FormatMXN(v.Car.Price), v.Claim))
+		}
+	}
+	return "Tu respuesta anterior tenía errores. Corrígela usando solo autos y precios del catálogo:\n" +
+		strings.Join(lines, "\n")
+}
@@ -0,0 +1,300 @@
+package grounding
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+)
+
+const (
+	UnknownCar = "unknown_car"
+	WrongPrice = "wrong_price"
+)
+
+// Violation is a claim in an answer that isn't backed by the catalog.
+type Violation struct {
+	Kind string
+	// Line is the answer line where the claim was found.
+	Line string
+	// Claim is the offending text: a car name or an amount.
+	Claim string
+	// Car is the catalog car the claim was checked against, if any.
+	Car *catalog.Car
+}
+
+func (v Violation) String() string {
+	if v.Kind == WrongPrice && v.Car != nil {
+		return fmt.Sprintf("%s: %q for %s %s %s (catalog price %.0f MXN)", v.Kind, v.Claim, v.Car.Make, v.Car.Model, v.Car.Version, v.Car.Price)
+	}
+	return fmt.Sprintf("%s: %q", v.Kind, v.Claim)
+}
+
+// otherMakes are brands that aren't necessarily in the catalog but that the
+// model likes to mention, so that invented cars of those brands are caught.
+// Brands that are also ordinary words are in wordMakes.
+var otherMakes = []string{
+	"Acura", "Alfa Romeo", "Audi", "BMW", "BYD", "Buick", "Cadillac", "Chevrolet",
+	"Chirey", "Chrysler", "Cupra", "Dodge", "Fiat", "Ford", "GMC", "Honda",
+	"Hyundai", "Infiniti", "JAC", "Jaguar", "Jeep", "KIA", "Land Rover", "Lexus",
+	"Lincoln", "Mazda", "Mercedes Benz", "Mercedes", "MG", "Mini", "Mitsubishi",
+	"Nissan", "Peugeot", "Porsche", "RAM", "Renault", "Seat", "Subaru", "Suzuki",
+	"Tesla", "Toyota", "Volkswagen", "Volvo",
+}
+
+// wordMakes are brands that are also ordinary words ("seat", "mini", "ram"),
+// so they only count when written with the brand's capitalization.
+var wordMakes = map[string]string{
+	"seat":   "Seat",
+	"mini":   "Mini",
+	"ram":    "RAM",
+	"jaguar": "Jaguar",
+}
+
+var (
+	// amountRe matches 461,999.00 as well as the Portuguese 461.999,00.
+	amountRe = regexp.MustCompile(`(\$\s?)?(\d{1,3}(?:,\d{3})+|\d{1,3}(?:\.\d{3})+|\d+)([.,]\d{1,2})?(\s*(?:MXN|pesos|km|kms)\b)?`)
+	yearRe   = regexp.MustCompile(`\b(19|20)\d{2}\b`)
+	priceRe  = priceWordsRe(i18n.PriceWords())
+)
+
+// Validator checks LLM answers against the catalog.
+type Validator struct {
+	cars  []catalog.Car
+	makes []string
+}
+
+func NewValidator(cars []catalog.Car) *Validator {
+	seen := make(map[string]bool)
+	var makes []string
+	for _, m := range otherMakes {
+		seen[normalize(m)] = true
+		makes = append(makes, normalize(m))
+	}
+	for _, c := range cars {
+		if m := normalize(c.Make); !seen[m] {
+			seen[m] = true
+			makes = append(makes, m)
+		}
+	}
+	return &Validator{cars: cars, makes: makes}
+}
+
+// priceWordsRe matches any of words as a whole word, in any case.
+func priceWordsRe(words []string) *regexp.Regexp {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	return regexp.MustCompile(`(?i)(?:^|[^\p{L}])(?:` + strings.Join(quoted, "|") + `)(?:[^\p{L}]|$)`)
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.ReplaceAll(s, "-", " "))
+}
+
+// Check returns the car names and prices in answer that don't match the
+// catalog. recent are the cars last recommended in the session; a price
+// quoted without naming a car must match one of them.
+func (v *Validator) Check(answer string, recent []catalog.Car) []Violation {
+	var violations []Violation
+	var current *catalog.Car
+
+	for _, line := range strings.Split(answer, "\n") {
+		amount, amountText, hasAmount := firstPrice(line)
+		hasYear := yearRe.MatchString(line)
+		isPriceLine := priceRe.MatchString(line)
+
+		brand, car := v.findCar(line)
+		switch {
+		case car != nil:
+			current = car
+		case brand != "" && (hasAmount || hasYear):
+			violations = append(violations, Violation{Kind: UnknownCar, Line: line, Claim: strings.TrimSpace(line)})
+			current = nil
+			continue
+		}
+
+		if !hasAmount || (car == nil && !isPriceLine) {
+			continue
+		}
+
+		switch {
+		case car != nil:
+			if !samePrice(amount, car.Price) {
+				violations = append(violations, Violation{Kind: WrongPrice, Line: line, Claim: amountText, Car: car})
+			}
+		case current != nil:
+			if !samePrice(amount, current.Price) {
+				violations = append(violations, Violation{Kind: WrongPrice, Line: line, Claim: amountText, Car: current})
+			}
+		case len(recent) > 0:
+			if !anyPrice(amount, recent) {
+				violations = append(violations, Violation{Kind: WrongPrice, Line: line, Claim: amountText, Car: &recent[0]})
+			}
+		}
+	}
+	return violations
+}
+
+// findCar returns the brand mentioned in line and, when the brand and one of
+// its models are in the catalog, the best matching catalog car.
+func (v *Validator) findCar(line string) (string, *catalog.Car) {
+	norm := normalize(line)
+
+	var brand string
+	for _, m := range v.makes {
+		if len(m) <= len(brand) || !containsWord(norm, m) {
+			continue
+		}
+		if written, ok := wordMakes[m]; ok && !containsWord(strings.ReplaceAll(line, "-", " "), written) {
+			continue
+		}
+		brand = m
+	}
+	if brand == "" {
+		return "", nil
+	}
+
+	var best *catalog.Car
+	bestScore := 0
+	for i := range v.cars {
+		c := &v.cars[i]
+		if !strings.HasPrefix(normalize(c.Make), brand) && !strings.HasPrefix(brand, normalize(c.Make)) {
+			continue
+		}
+		if !containsWord(norm, normalize(c.Model)) {
+			continue
+		}
+		score := 1
+		if strings.Contains(norm, strconv.Itoa(c.Year)) {
+			score++
+		}
+		if c.Version != "" && strings.Contains(norm, normalize(c.Version)) {
+			score += 2
+		}
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	return brand, best
+}
+
+func containsWord(s, word string) bool {
+	idx := strings.Index(s, word)
+	for idx >= 0 {
+		before := idx == 0 || !isWordByte(s[idx-1])
+		end := idx + len(word)
+		after := end == len(s) || !isWordByte(s[end])
+		if before && after {
+			return true
+		}
+		next := strings.Index(s[idx+1:], word)
+		if next < 0 {
+			break
+		}
+		idx += next + 1
+	}
+	return false
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// firstPrice returns the first amount in line that looks like money: it has
+// a currency marker or thousands separators and isn't a distance.
+func firstPrice(line string) (float64, string, bool) {
+	amount, m, ok := firstAmount(line, false)
+	if !ok {
+		return 0, "", false
+	}
+	return amount, strings.TrimSpace(m[0]), true
+}
+
+// Amount returns the first amount in s that isn't a distance and the digits
+// it was written with, e.g. "7,623.45" for "$7,623.45 MXN". Unlike the price
+// check it accepts bare numbers, for text whose label says it's money.
+func Amount(s string) (float64, string, bool) {
+	amount, m, ok := firstAmount(s, true)
+	if !ok {
+		return 0, "", false
+	}
+	return amount, m[2] + m[3], true
+}
+
+func firstAmount(line string, bare bool) (float64, []string, bool) {
+	for _, m := range amountRe.FindAllStringSubmatch(line, -1) {
+		unit := strings.ToLower(strings.TrimSpace(m[4]))
+		if unit == "km" || unit == "kms" {
+			continue
+		}
+		if !bare && m[1] == "" && unit == "" && !strings.ContainsAny(m[2], ",.") {
+			continue
+		}
+		digits := strings.NewReplacer(",", "", ".", "").Replace(m[2])
+		amount, err := strconv.ParseFloat(digits+strings.Replace(m[3], ",", ".", 1), 64)
+		if err != nil {
+			continue
+		}
+		return amount, m, true
+	}
+	return 0, nil, false
+}
+
+func samePrice(amount, price float64) bool {
+	return math.Abs(amount-price) <= 1
+}
+
+func anyPrice(amount float64, cars []catalog.Car) bool {
+	for _, c := range cars {
+		if samePrice(amount, c.Price) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rewrite fixes answer in place: wrong prices are replaced by the catalog
+// price and lines naming cars that aren't in the catalog are dropped.
+func Rewrite(answer string, violations []Violation) string {
+	drop := make(map[string]bool)
+	fix := make(map[string][]Violation)
+	for _, v := range violations {
+		switch v.Kind {
+		case UnknownCar:
+			drop[v.Line] = true
+		case WrongPrice:
+			fix[v.Line] = append(fix[v.Line], v)
+		}
+	}
+
+	var out []string
+	for _, line := range strings.Split(answer, "\n") {
+		if drop[line] {
+			continue
+		}
+		for _, v := range fix[line] {
+			line = strings.Replace(line, v.Claim, FormatMXN(v.Car.Price)+" MXN", 1)
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// FormatMXN formats amount with thousands separators and no decimals.
+func FormatMXN(amount float64) string {
+	s := strconv.FormatFloat(math.Round(amount), 'f', 0, 64)
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
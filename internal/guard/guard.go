@@ -0,0 +1,93 @@
+package guard
+
+import (
+	"context"
+	"log"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+)
+
+type Decision string
+
+const (
+	Allow    Decision = "allow"
+	Refuse   Decision = "refuse"
+	Sanitize Decision = "sanitize"
+	Escalate Decision = "escalate"
+)
+
+// Rule inspects a user message. Match reports whether the rule applies and,
+// for rules that can clean the message up, returns the sanitized text.
+type Rule interface {
+	Name() string
+	Match(ctx context.Context, text string) (matched bool, sanitized string)
+}
+
+// Verdict is what the guard decided for one message.
+type Verdict struct {
+	Decision Decision
+	Rule     string
+	// Text is the message to process; it differs from the input only when
+	// the decision is Sanitize.
+	Text string
+}
+
+type step struct {
+	rule     Rule
+	decision Decision
+}
+
+// Guard runs the configured rules in order before a message reaches the LLM.
+// The first rule that matches decides.
+type Guard struct {
+	steps []step
+}
+
+func New(cfg config.GuardConfig, rules ...Rule) *Guard {
+	g := &Guard{}
+	for _, r := range rules {
+		decision := Decision(cfg.Actions[r.Name()])
+		if decision == "" {
+			decision = Refuse
+		}
+		g.steps = append(g.steps, step{rule: r, decision: decision})
+	}
+	return g
+}
+
+func (g *Guard) Inspect(ctx context.Context, sessionID, text string) Verdict {
+	for _, s := range g.steps {
+		matched, sanitized := s.rule.Match(ctx, text)
+		if !matched {
+			continue
+		}
+
+		v := Verdict{Decision: s.decision, Rule: s.rule.Name(), Text: text}
+		switch s.decision {
+		case Sanitize:
+			if sanitized == "" {
+				// Nothing left to answer once the offending part is gone.
+				v.Decision = Refuse
+			} else {
+				v.Text = sanitized
+			}
+		case Escalate, Allow:
+		default:
+			v.Decision = Refuse
+		}
+
+		metrics.GuardDecisions.WithLabelValues(v.Rule, string(v.Decision)).Inc()
+		log.Printf("guard: session %s: rule %s decided %s", sessionID, v.Rule, v.Decision)
+		return v
+	}
+
+	metrics.GuardDecisions.WithLabelValues("none", string(Allow)).Inc()
+	return Verdict{Decision: Allow, Text: text}
+}
+
+// Blocked reports whether the message must not reach the LLM and should get
+// a canned refusal or escalation answer instead.
+func (v Verdict) Blocked() bool {
+	return v.Decision == Refuse || v.Decision == Escalate
+}
@@ -0,0 +1,146 @@
+package guard
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// PatternRule matches messages against regular expressions. Sanitizing
+// replaces every match with replacement.
+type PatternRule struct {
+	name        string
+	patterns    []*regexp.Regexp
+	replacement string
+}
+
+func NewPatternRule(name, replacement string, patterns ...string) *PatternRule {
+	r := &PatternRule{name: name, replacement: replacement}
+	for _, p := range patterns {
+		r.patterns = append(r.patterns, regexp.MustCompile(p))
+	}
+	return r
+}
+
+func (r *PatternRule) Name() string {
+	return r.name
+}
+
+func (r *PatternRule) Match(ctx context.Context, text string) (bool, string) {
+	matched := false
+	sanitized := text
+	for _, p := range r.patterns {
+		if p.MatchString(sanitized) {
+			matched = true
+			sanitized = p.ReplaceAllString(sanitized, r.replacement)
+		}
+	}
+	return matched, strings.TrimSpace(sanitized)
+}
+
+// InjectionRule catches attempts to override the system prompt.
+func InjectionRule() *PatternRule {
+	return NewPatternRule("injection", "",
+		`(?i)(ignora|olvida|omite|desobedece)\s+(todas\s+)?(tus|las|sus)\s+(instrucciones|reglas|indicaciones)(\s+(anteriores|previas))?`,
+		`(?i)(ignore|forget|disregard)\s+(all\s+)?(your|the|previous|prior)\s+(previous\s+|prior\s+)?(instructions|rules|prompt)`,
+		`(?i)(revela|muestra|dime|imprime)\s+(tu|el)\s+(prompt|mensaje\s+de\s+sistema|instrucciones\s+de\s+sistema)`,
+		`(?i)(system\s+prompt|prompt\s+del\s+sistema)`,
+		`(?i)(a\s+partir\s+de\s+ahora|desde\s+ahora)\s+eres`,
+		`(?i)you\s+are\s+now\b`,
+		`(?i)(modo\s+desarrollador|developer\s+mode|jailbreak)`,
+	)
+}
+
+// AbuseRule catches insults; sanitizing masks them.
+func AbuseRule() *PatternRule {
+	return NewPatternRule("abuse", "***",
+		`(?i)\b(pendej[oa]s?|idiotas?|est[uú]pid[oa]s?|imb[eé]ciles?|put[oa]s?|mierdas?|chinga(r|da|tu)?|cabr[oó]n(es)?|malparid[oa]s?|fuck(ing)?|bitch)\b`,
+	)
+}
+
+// SpamRule catches promotional spam and flooding. Sanitizing drops links and
+// truncates the message to maxLength.
+type SpamRule struct {
+	maxLength int
+	links     *regexp.Regexp
+	promo     *regexp.Regexp
+}
+
+// floodRun is how many repetitions of the same character count as flooding.
+const floodRun = 10
+
+func NewSpamRule(maxLength int) *SpamRule {
+	return &SpamRule{
+		maxLength: maxLength,
+		links:     regexp.MustCompile(`(?i)(https?://|www\.)\S+`),
+		promo:     regexp.MustCompile(`(?i)\b(bitcoin|cripto(monedas?)?|forex|gana\s+dinero|inversi[oó]n\s+garantizada|casino|apuestas|s[ií]gueme|followers)\b`),
+	}
+}
+
+func (r *SpamRule) Name() string {
+	return "spam"
+}
+
+func (r *SpamRule) Match(ctx context.Context, text string) (bool, string) {
+	tooLong := r.maxLength > 0 && len([]rune(text)) > r.maxLength
+	collapsed := collapseRuns(text)
+	if !tooLong && !r.links.MatchString(text) && !r.promo.MatchString(text) && collapsed == text {
+		return false, text
+	}
+
+	sanitized := r.links.ReplaceAllString(collapsed, "")
+	sanitized = r.promo.ReplaceAllString(sanitized, "")
+	if runes := []rune(sanitized); r.maxLength > 0 && len(runes) > r.maxLength {
+		sanitized = string(runes[:r.maxLength])
+	}
+	return true, strings.TrimSpace(sanitized)
+}
+
+// collapseRuns shortens runs of floodRun or more identical characters to a
+// single one.
+func collapseRuns(text string) string {
+	runes := []rune(text)
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && runes[j] == runes[i] {
+			j++
+		}
+		if j-i >= floodRun {
+			b.WriteRune(runes[i])
+		} else {
+			b.WriteString(string(runes[i:j]))
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// Moderator is implemented by llm.Client.
+type Moderator interface {
+	Moderate(ctx context.Context, text string) (bool, error)
+}
+
+// ModerationRule asks a moderation model. Errors let the message through so
+// an outage of the moderation API doesn't take the bot down.
+type ModerationRule struct {
+	moderator Moderator
+}
+
+func NewModerationRule(m Moderator) *ModerationRule {
+	return &ModerationRule{moderator: m}
+}
+
+func (r *ModerationRule) Name() string {
+	return "moderation"
+}
+
+func (r *ModerationRule) Match(ctx context.Context, text string) (bool, string) {
+	flagged, err := r.moderator.Moderate(ctx, text)
+	if err != nil {
+		log.Printf("guard: moderation model failed: %v", err)
+		return false, text
+	}
+	return flagged, ""
+}
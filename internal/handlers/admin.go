@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"carlospayan/agent-comercial-ai/internal/cache"
+	"carlospayan/agent-comercial-ai/internal/experiments"
+)
+
+// RequireAdmin lets through only the requests that carry token as their
+// bearer token. With no token configured the routes it guards don't exist.
+func RequireAdmin(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				http.NotFound(w, r)
+				return
+			}
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ExperimentsHandler shows the running experiment and the volume each
+// variant has received since startup.
+func ExperimentsHandler(exp *experiments.Experiment) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Experiment string              `json:"experiment"`
+			Variants   []experiments.Stats `json:"variants"`
+		}{
+			Experiment: exp.Name(),
+			Variants:   exp.Stats(),
+		})
+	}
+}
+
+// CacheInvalidateHandler empties the response cache, e.g. after the Kavak
+// info or the prompts were edited.
+func CacheInvalidateHandler(c *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"invalidated": c.Invalidate()})
+	}
+}
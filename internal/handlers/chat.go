@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/conversation"
+	"carlospayan/agent-comercial-ai/internal/customer"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+)
+
+type carView struct {
+	StockID   string  `json:"stock_id"`
+	Make      string  `json:"make"`
+	Model     string  `json:"model"`
+	Version   string  `json:"version"`
+	Year      int     `json:"year"`
+	Price     float64 `json:"price"`
+	KM        int     `json:"km"`
+	Bluetooth string  `json:"bluetooth,omitempty"`
+	CarPlay   string  `json:"car_play,omitempty"`
+}
+
+func newCarView(c catalog.Car) carView {
+	return carView{
+		StockID:   c.StockID,
+		Make:      c.Make,
+		Model:     c.Model,
+		Version:   c.Version,
+		Year:      c.Year,
+		Price:     c.Price,
+		KM:        c.KM,
+		Bluetooth: c.Bluetooth,
+		CarPlay:   c.CarPlay,
+	}
+}
+
+type chatResponse struct {
+	SessionID string    `json:"session_id"`
+	Message   string    `json:"message"`
+	Intent    string    `json:"intent,omitempty"`
+	Language  string    `json:"language,omitempty"`
+	Cars      []carView `json:"cars"`
+	Actions   []string  `json:"actions"`
+}
+
+// ChatHandler is the structured counterpart of RAGHandler: it answers with
+// the message, the catalog cars it refers to and suggested follow-up actions
+// so that web clients can render cards and buttons.
+func ChatHandler(engine *conversation.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chatStart := time.Now()
+
+		q := r.FormValue("q")
+		if strings.TrimSpace(q) == "" {
+			http.Error(w, "missing q parameter", http.StatusBadRequest)
+			return
+		}
+
+		sid := cookieSession(w, r)
+		ctx := customer.WithID(r.Context(), cookieCustomer(w, r))
+
+		reply, err := engine.Respond(ctx, sid, "chat", q, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resp := chatResponse{
+			SessionID: sid,
+			Message:   reply.Text,
+			Intent:    string(reply.Intent),
+			Language:  string(reply.Lang),
+			Cars:      []carView{},
+			Actions:   reply.Actions,
+		}
+		for _, id := range reply.StockIDs {
+			if car, ok := engine.Catalog.ByStockID(id); ok {
+				resp.Cars = append(resp.Cars, newCarView(car))
+			}
+		}
+		if resp.Actions == nil {
+			resp.Actions = []string{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+
+		chatLatency := time.Since(chatStart)
+		metrics.ChatHandlerLatency.Observe(float64(chatLatency.Milliseconds()))
+	}
+}
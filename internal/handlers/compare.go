@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/compare"
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/store"
+)
+
+// CompareHandler compares two to four catalog cars side by side. The cars
+// are the stock_ids query parameter (comma separated) or, when it's missing,
+// the last recommendations of session_id. down_payment, years and profile
+// set the terms of the estimated payments; by default they're the session's.
+func CompareHandler(cat *catalog.Catalog, calc *financing.Calculator, sessions store.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		sid := q.Get("session_id")
+
+		var refs []string
+		for _, v := range q["stock_ids"] {
+			refs = append(refs, strings.Split(v, ",")...)
+		}
+		var recent []catalog.Car
+		var terms financing.Terms
+		if sid != "" {
+			recent = sessions.GetRecommendations(sid)
+			terms = sessions.GetFinancingTerms(sid)
+		}
+
+		cars, err := compare.Resolve(cat, recent, refs)
+		var notFound *compare.NotFoundError
+		if errors.As(err, &notFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if len(refs) == 0 {
+			cars = recent
+			if len(cars) > compare.MaxCars {
+				cars = cars[:compare.MaxCars]
+			}
+		}
+
+		var req financing.Terms
+		if v := q.Get("down_payment"); v != "" {
+			if req.DownPayment, err = strconv.ParseFloat(v, 64); err != nil {
+				http.Error(w, "invalid down_payment parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := q.Get("years"); v != "" {
+			if req.Years, err = strconv.Atoi(v); err != nil {
+				http.Error(w, "invalid years parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		var ok bool
+		if req.Profile, ok = financing.ParseProfile(q.Get("profile")); !ok {
+			http.Error(w, "invalid profile", http.StatusBadRequest)
+			return
+		}
+
+		c, err := compare.Compare(cars, calc, terms.Merge(req))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c)
+	}
+}
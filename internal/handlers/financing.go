@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/conversation"
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+)
+
+type simulateRequest struct {
+	StockID     string  `json:"stock_id"`
+	DownPayment float64 `json:"down_payment"`
+	Years       int     `json:"years"`
+	// Profile is the declared credit profile: excellent, good, fair,
+	// limited or empty.
+	Profile string `json:"profile"`
+}
+
+// FinancingSimulateHandler simulates a plan for a catalog car and answers
+// the plan with its month-by-month amortization table. ?format=csv or
+// ?format=html render the quote instead of JSON.
+func FinancingSimulateHandler(cat *catalog.Catalog, calc *financing.Calculator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req simulateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		serveQuote(w, r, cat, calc, req)
+	}
+}
+
+// FinancingQuoteHandler renders the quote described by the query string
+// (stock_id, down_payment, years, profile, format, lang). It's what WhatsApp users get
+// a link to, so the default format is HTML.
+func FinancingQuoteHandler(cat *catalog.Catalog, calc *financing.Calculator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		req := simulateRequest{StockID: q.Get("stock_id"), Profile: q.Get("profile")}
+		var err error
+		if req.DownPayment, err = strconv.ParseFloat(q.Get("down_payment"), 64); err != nil {
+			http.Error(w, "invalid down_payment parameter", http.StatusBadRequest)
+			return
+		}
+		if y := q.Get("years"); y != "" {
+			if req.Years, err = strconv.Atoi(y); err != nil {
+				http.Error(w, "invalid years parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		if q.Get("format") == "" {
+			q.Set("format", "html")
+			r.URL.RawQuery = q.Encode()
+		}
+		serveQuote(w, r, cat, calc, req)
+	}
+}
+
+func serveQuote(w http.ResponseWriter, r *http.Request, cat *catalog.Catalog, calc *financing.Calculator, req simulateRequest) {
+	if strings.TrimSpace(req.StockID) == "" {
+		http.Error(w, "missing stock_id", http.StatusBadRequest)
+		return
+	}
+	profile, ok := financing.ParseProfile(req.Profile)
+	if !ok {
+		http.Error(w, "invalid profile", http.StatusBadRequest)
+		return
+	}
+	car, ok := cat.ByStockID(req.StockID)
+	if !ok {
+		http.Error(w, "car not found", http.StatusNotFound)
+		return
+	}
+	plan, err := calc.SimulateProfile(profile, car.Price, req.DownPayment, req.Years)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, financing.ErrInvalidPrice) {
+			status = http.StatusInternalServerError
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	quote := financing.NewQuote(car.StockID, fmt.Sprintf("%s %s %s (%d)", car.Make, car.Model, car.Version, car.Year), plan)
+
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="cotizacion-%s.csv"`, car.StockID))
+		quote.WriteCSV(w)
+	case "html":
+		lang, ok := i18n.Parse(r.URL.Query().Get("lang"))
+		if !ok {
+			lang = i18n.Default
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		quote.WriteHTML(w, lang)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(quote)
+	}
+}
+
+// quoteLink is the public URL of the quote a reply describes.
+func quoteLink(baseURL string, q *conversation.QuoteRequest, lang i18n.Lang) string {
+	v := url.Values{}
+	v.Set("stock_id", q.StockID)
+	v.Set("down_payment", strconv.FormatFloat(q.DownPayment, 'f', -1, 64))
+	if q.Years > 0 {
+		v.Set("years", strconv.Itoa(q.Years))
+	}
+	if q.Profile != financing.Unknown {
+		v.Set("profile", string(q.Profile))
+	}
+	v.Set("lang", string(lang))
+	return strings.TrimRight(baseURL, "/") + "/v1/financing/quote?" + v.Encode()
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"carlospayan/agent-comercial-ai/internal/customer"
+	"carlospayan/agent-comercial-ai/internal/store"
+)
+
+// customerCookie identifies a web customer across sessions for a year.
+const customerCookie = "customer_id"
+
+// cookieID returns the value of cookie name when it's one of the UUIDs the
+// web cookies are set to. Anything else, like a WhatsApp number, is
+// ignored: those IDs would let a browser read and write the sessions and
+// profiles of WhatsApp customers.
+func cookieID(r *http.Request, name string) (string, bool) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	if _, err := uuid.Parse(cookie.Value); err != nil {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// cookieCustomer returns the customer ID stored in the customer_id cookie,
+// setting a new one when the cookie is missing or wasn't set by us.
+func cookieCustomer(w http.ResponseWriter, r *http.Request) string {
+	if id, ok := cookieID(r, customerCookie); ok {
+		return id
+	}
+
+	id := uuid.New().String()
+	http.SetCookie(w, &http.Cookie{
+		Name:     customerCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+type profileView struct {
+	CustomerID string `json:"customer_id"`
+	customer.Profile
+}
+
+// ProfileHandler shows the profile of the customer of the customer_id
+// cookie: the preferences remembered from their conversations.
+func ProfileHandler(sessions store.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := cookieID(r, customerCookie)
+		if !ok {
+			http.Error(w, "profile not found", http.StatusNotFound)
+			return
+		}
+		writeProfile(w, sessions, id)
+	}
+}
+
+// DeleteProfileHandler forgets the profile of the customer of the
+// customer_id cookie and the conversation of the session_id cookie, which
+// has the profile in its history. Deleting a profile that doesn't exist
+// succeeds too.
+func DeleteProfileHandler(sessions store.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := cookieID(r, customerCookie); ok {
+			sessions.DeleteProfile(id)
+		}
+		if sid, ok := cookieID(r, "session_id"); ok {
+			sessions.DeleteHistory(sid)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// CustomerProfileHandler shows the profile of any customer, like a
+// WhatsApp number, for the admin routes.
+func CustomerProfileHandler(sessions store.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeProfile(w, sessions, chi.URLParam(r, "customerID"))
+	}
+}
+
+// DeleteCustomerProfileHandler forgets the profile of any customer for the
+// admin routes. A WhatsApp customer's session is keyed by the same number,
+// so their conversation is forgotten too.
+func DeleteCustomerProfileHandler(sessions store.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "customerID")
+		sessions.DeleteProfile(id)
+		sessions.DeleteHistory(id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeProfile(w http.ResponseWriter, sessions store.SessionStore, id string) {
+	p, ok := sessions.GetProfile(id)
+	if !ok {
+		http.Error(w, "profile not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profileView{CustomerID: id, Profile: p})
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/store"
+	"carlospayan/agent-comercial-ai/internal/tradein"
+)
+
+// cookieSession returns the session ID stored in the session_id cookie,
+// setting a new one when the cookie is missing or wasn't set by us.
+func cookieSession(w http.ResponseWriter, r *http.Request) string {
+	if sid, ok := cookieID(r, "session_id"); ok {
+		return sid
+	}
+
+	sid := uuid.New().String()
+	http.SetCookie(w, &http.Cookie{
+		Name:  "session_id",
+		Value: sid,
+		Path:  "/",
+	})
+	return sid
+}
+
+type sessionView struct {
+	SessionID       string           `json:"session_id"`
+	Language        string           `json:"language,omitempty"`
+	Variant         string           `json:"variant,omitempty"`
+	PromptVersion   string           `json:"prompt_version,omitempty"`
+	Messages        int              `json:"messages"`
+	StartedAt       *time.Time       `json:"started_at,omitempty"`
+	LastMessageAt   time.Time        `json:"last_message_at"`
+	LastCar         *carView         `json:"last_car"`
+	Recommendations []carView        `json:"recommendations"`
+	FinancingTerms  financing.Terms  `json:"financing_terms"`
+	TradeIn         *tradein.TradeIn `json:"trade_in,omitempty"`
+}
+
+// SessionHandler shows what the engine knows about a session: the car the
+// conversation is about (last_car, with its current catalog data), the last
+// recommendations, the financing terms and the trade-in.
+func SessionHandler(sessions store.SessionStore, cat *catalog.Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sid := chi.URLParam(r, "sessionID")
+		activity, ok := sessions.Activity(sid)
+		if !ok {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+
+		view := sessionView{
+			SessionID:       sid,
+			Messages:        len(sessions.GetHistory(sid)),
+			LastMessageAt:   activity.LastMessage,
+			Recommendations: []carView{},
+			FinancingTerms:  sessions.GetFinancingTerms(sid),
+		}
+		if lang, ok := sessions.GetLanguage(sid); ok {
+			view.Language = string(lang)
+		}
+		view.Variant, _ = sessions.GetVariant(sid)
+		view.PromptVersion, _ = sessions.GetPromptVersion(sid)
+		if !activity.Started.IsZero() {
+			view.StartedAt = &activity.Started
+		}
+		if car, ok := sessions.GetLastCar(sid); ok {
+			if fresh, ok := cat.ByStockID(car.StockID); ok {
+				car = fresh
+			}
+			v := newCarView(car)
+			view.LastCar = &v
+		}
+		for _, car := range sessions.GetRecommendations(sid) {
+			view.Recommendations = append(view.Recommendations, newCarView(car))
+		}
+		if t := sessions.GetTradeIn(sid); t.Active() || t.Car != (tradein.Car{}) {
+			view.TradeIn = &t
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(view)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/conversation"
+	"carlospayan/agent-comercial-ai/internal/customer"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+)
+
+// ChatStreamHandler answers like RAGHandler but sends the answer tokens as
+// Server-Sent Events while the LLM produces them. The question is read from
+// the q query parameter or, for POST, from the q form field.
+//
+// Every token is a "token" event with {"delta": ...}. Grounding and critique
+// check the answer only once it's complete and may rewrite it; when they do,
+// a "replace" event with {"answer": ...} follows the tokens, and clients
+// must replace the text they showed with it. The final "done" event always
+// carries the complete answer.
+func ChatStreamHandler(engine *conversation.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		streamStart := time.Now()
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		q := r.FormValue("q")
+		if strings.TrimSpace(q) == "" {
+			http.Error(w, "missing q parameter", http.StatusBadRequest)
+			return
+		}
+
+		sid := cookieSession(w, r)
+		ctx := customer.WithID(r.Context(), cookieCustomer(w, r))
+
+		// Headers are sent with the first token so that failures before the
+		// LLM starts answering can still be reported with a status code.
+		started := false
+		var streamed strings.Builder
+		reply, err := engine.Respond(ctx, sid, "chat_stream", q, func(delta string) error {
+			if !started {
+				startEventStream(w)
+				started = true
+			}
+			streamed.WriteString(delta)
+			if err := writeEvent(w, "token", map[string]string{"delta": delta}); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		})
+		if err != nil {
+			if r.Context().Err() != nil {
+				log.Printf("stream for session %s cancelled by client: %v", sid, r.Context().Err())
+				return
+			}
+			if !started {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeEvent(w, "error", map[string]string{"error": err.Error()})
+			flusher.Flush()
+			return
+		}
+
+		if !started {
+			startEventStream(w)
+		}
+		switch {
+		case !reply.Streamed:
+			writeEvent(w, "token", map[string]string{"delta": reply.Text})
+		case streamed.String() != reply.Text:
+			writeEvent(w, "replace", map[string]string{"answer": reply.Text})
+		}
+		writeEvent(w, "done", map[string]string{"answer": reply.Text})
+		flusher.Flush()
+
+		streamLatency := time.Since(streamStart)
+		metrics.StreamHandlerLatency.Observe(float64(streamLatency.Milliseconds()))
+	}
+}
+
+func startEventStream(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeEvent writes a single SSE event with a JSON payload, so that newlines
+// inside the tokens never break the event framing.
+func writeEvent(w http.ResponseWriter, event string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"carlospayan/agent-comercial-ai/internal/store"
+)
+
+// UsageHandler returns the running token and cost totals of a session's
+// conversation.
+func UsageHandler(sessions store.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sid := chi.URLParam(r, "sessionID")
+		totals, ok := sessions.GetUsage(sid)
+		if !ok {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(totals)
+	}
+}
@@ -7,19 +7,15 @@ import (
 	"strings"
 	"time"
 
-	"github.com/sashabaranov/go-openai"
-
-	"carlospayan/agent-comercial-ai/internal/catalog"
-	"carlospayan/agent-comercial-ai/internal/config"
-	"carlospayan/agent-comercial-ai/internal/llm"
+	"carlospayan/agent-comercial-ai/internal/conversation"
+	"carlospayan/agent-comercial-ai/internal/customer"
+	"carlospayan/agent-comercial-ai/internal/i18n"
 	"carlospayan/agent-comercial-ai/internal/metrics"
-	"carlospayan/agent-comercial-ai/internal/store"
 )
 
-func WhatsAppHandler(cfg *config.Config, kavakInfo string, cat *catalog.Catalog) http.HandlerFunc {
-
-	client := llm.NewClient(cfg.OpenAI.APIKey)
-
+// WhatsAppHandler answers the Twilio webhook. Financing plans get a link to
+// their full quote under publicURL, when set.
+func WhatsAppHandler(engine *conversation.Engine, publicURL string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		whatsappStart := time.Now()
 		if err := r.ParseForm(); err != nil {
@@ -29,78 +25,38 @@ func WhatsAppHandler(cfg *config.Config, kavakInfo string, cat *catalog.Catalog)
 
 		userBody := r.FormValue("Body")
 		from := r.FormValue("From")
-		if strings.TrimSpace(userBody) == "" || strings.TrimSpace(from) == "" {
+		mediaURL := r.FormValue("MediaUrl0")
+		if (strings.TrimSpace(userBody) == "" && mediaURL == "") || strings.TrimSpace(from) == "" {
 			http.Error(w, "parameters 'Body' or 'From' missing", http.StatusBadRequest)
 			return
 		}
 
 		sid := from
-
-		history := store.GetHistory(sid)
-		if len(history) == 0 {
-			store.AppendMessage(sid, openai.ChatCompletionMessage{
-				Role:    "system",
-				Content: SYSTEM_INSTRUCCTIONS,
-			})
-			store.AppendMessage(sid, openai.ChatCompletionMessage{
-				Role: "assistant",
-				Content: fmt.Sprintf(
-					"Información de Kavak (propuesta de valor y sucursales):\n%s",
-					kavakInfo,
-				),
-			})
+		ctx := customer.WithID(r.Context(), from)
+
+		var reply conversation.Reply
+		var err error
+		if mediaURL != "" {
+			reply, err = engine.RespondMedia(ctx, sid, "whatsapp", userBody, mediaURL, r.FormValue("MediaContentType0"))
+		} else {
+			var joined bool
+			reply, joined, err = engine.RespondDebounced(ctx, sid, "whatsapp", userBody)
+			if err == nil && joined {
+				// The answer goes with the first message of the turn.
+				writeTwiML(w, "")
+				return
+			}
 		}
-
-		catStart := time.Now()
-		autos, err := cat.Search(r.Context(), userBody, 3)
-		catLatency := time.Since(catStart)
-		metrics.CatLatency.Observe(float64(catLatency.Milliseconds()))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("error searching in catalog: %v", err), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		var recs []string
-		for i, a := range autos {
-			recs = append(recs, fmt.Sprintf(
-				"%d) %s %s %s (%d) – Precio: %.2f MXN, Kilometraje: %d km",
-				i+1, a.Make, a.Model, a.Version, a.Year, a.Price, a.KM,
-			))
-		}
-		bloqueRecs := "Nuevas recomendaciones (top-3) basadas en tu mensaje:\n" +
-			strings.Join(recs, "\n")
-
-		store.AppendMessage(sid, openai.ChatCompletionMessage{
-			Role:    "assistant",
-			Content: bloqueRecs,
-		})
-
-		store.AppendMessage(sid, openai.ChatCompletionMessage{
-			Role:    "user",
-			Content: userBody,
-		})
-
-		llmStart := time.Now()
-		history = store.GetHistory(sid)
-		answer, err := client.Chat(r.Context(), history)
-		llmLatency := time.Since(llmStart)
-		metrics.LLMLatency.Observe(float64(llmLatency.Milliseconds()))
-		if err != nil {
-			http.Error(w, fmt.Sprintf("error calling LLM: %v", err), http.StatusInternalServerError)
-			return
+		text := reply.Text
+		if reply.Quote != nil && publicURL != "" {
+			text += "\n\n" + fmt.Sprintf(i18n.Message(reply.Lang, i18n.QuoteLink), quoteLink(publicURL, reply.Quote, reply.Lang))
 		}
-
-		store.AppendMessage(sid, openai.ChatCompletionMessage{
-			Role:    "assistant",
-			Content: answer,
-		})
-
-		w.Header().Set("Content-Type", "application/xml")
-		responseXML := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-<Response>
-  <Message>%s</Message>
-</Response>`, escapeForXML(answer))
-		w.Write([]byte(responseXML))
+		writeTwiML(w, text)
 
 		whatsappLatency := time.Since(whatsappStart)
 		metrics.WhatsappHandlerLatency.Observe(float64(whatsappLatency.Milliseconds()))
@@ -108,6 +64,22 @@ func WhatsAppHandler(cfg *config.Config, kavakInfo string, cat *catalog.Catalog)
 
 }
 
+// writeTwiML answers the Twilio webhook with a single message, or with no
+// message when it's empty.
+func writeTwiML(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	if message == "" {
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Response></Response>`))
+		return
+	}
+	responseXML := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<Response>
+  <Message>%s</Message>
+</Response>`, escapeForXML(message))
+	w.Write([]byte(responseXML))
+}
+
 func escapeForXML(s string) string {
 	replacer := strings.NewReplacer(
 		"&", "&amp;",
@@ -0,0 +1,160 @@
+package i18n
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Lang is a supported conversation language.
+type Lang string
+
+const (
+	Spanish    Lang = "es"
+	English    Lang = "en"
+	Portuguese Lang = "pt"
+)
+
+// Default is the language of sessions whose language can't be told.
+const Default = Spanish
+
+func Parse(s string) (Lang, bool) {
+	switch Lang(strings.ToLower(s)) {
+	case Spanish:
+		return Spanish, true
+	case English:
+		return English, true
+	case Portuguese:
+		return Portuguese, true
+	}
+	return "", false
+}
+
+// Name is how the language is called in instructions to the model.
+func (l Lang) Name() string {
+	switch l {
+	case English:
+		return "inglés"
+	case Portuguese:
+		return "portugués"
+	default:
+		return "español"
+	}
+}
+
+// markers are words that are common in one language and rare in the other
+// two. Words shared by Spanish and Portuguese (que, de, para...) are left out
+// on purpose.
+var markers = map[Lang][]string{
+	Spanish: {
+		"el", "los", "las", "y", "usted", "tienen", "tienes", "quiero", "hola", "cuánto", "cuanto",
+		"cómo", "qué", "gracias", "auto", "autos", "coche", "busco", "una", "con", "es", "está",
+		"buenos", "días", "dónde", "donde", "precio", "enganche", "cuesta", "sí", "muy", "pero",
+	},
+	English: {
+		"the", "a", "an", "is", "are", "do", "you", "have", "what", "how", "much", "i", "want",
+		"looking", "for", "car", "cars", "hello", "hi", "thanks", "thank", "price", "with", "my",
+		"can", "does", "which", "where", "payment", "down", "good", "morning", "please",
+	},
+	Portuguese: {
+		"você", "voce", "vocês", "voces", "tem", "têm", "não", "nao", "olá", "ola", "obrigado",
+		"obrigada", "carro", "carros", "quanto", "custa", "estou", "procurando", "uma", "com",
+		"é", "bom", "dia", "onde", "ficam", "gostaria", "entrada", "parcela", "também", "tambem", "eu",
+	},
+}
+
+// priceWords introduce the price of a car in an answer, like the "Precio",
+// "Price" and "Preço" labels of RecommendationLine.
+var priceWords = map[Lang][]string{
+	Spanish:    {"precio", "precios", "cuesta", "cuestan", "vale", "valen"},
+	English:    {"price", "prices", "priced", "cost", "costs"},
+	Portuguese: {"preço", "preços", "preco", "custa", "custam", "vale", "valor"},
+}
+
+// PriceWords returns the words of every language that introduce a price.
+func PriceWords() []string {
+	var words []string
+	for _, lang := range []Lang{Spanish, English, Portuguese} {
+		words = append(words, priceWords[lang]...)
+	}
+	return words
+}
+
+// Detect guesses the language of text. ok is false when no language clearly
+// leads, e.g. for "ok" or a bare car model.
+func Detect(text string) (Lang, bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	scores := make(map[Lang]int)
+	for _, w := range words {
+		for lang, list := range markers {
+			for _, m := range list {
+				if w == m {
+					scores[lang]++
+				}
+			}
+		}
+	}
+	if strings.Contains(text, "ção") || strings.Contains(text, "ções") || strings.Contains(text, "ão") {
+		scores[Portuguese] += 2
+	}
+	if strings.ContainsAny(text, "¿¡ñ") {
+		scores[Spanish] += 2
+	}
+
+	best, bestScore, second := Default, 0, 0
+	for _, lang := range []Lang{Spanish, English, Portuguese} {
+		switch s := scores[lang]; {
+		case s > bestScore:
+			best, bestScore, second = lang, s, bestScore
+		case s > second:
+			second = s
+		}
+	}
+	if bestScore == 0 || bestScore == second {
+		return Default, false
+	}
+	return best, true
+}
+
+// FormatNumber formats n with decimals using the separators of the locale:
+// 461,999.00 in Spanish (Mexico) and English, 461.999,00 in Portuguese.
+func FormatNumber(l Lang, n float64, decimals int) string {
+	s := strconv.FormatFloat(math.Abs(n), 'f', decimals, 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+
+	thousands, decimal := ",", "."
+	if l == Portuguese {
+		thousands, decimal = ".", ","
+	}
+
+	var b strings.Builder
+	if n < 0 {
+		b.WriteByte('-')
+	}
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(thousands)
+		}
+		b.WriteRune(r)
+	}
+	if frac != "" {
+		b.WriteString(decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// NoteAmount formats an amount for the notes to the model, which are in
+// Spanish whatever the language of the conversation.
+func NoteAmount(amount float64) string {
+	return FormatNumber(Spanish, amount, 2)
+}
+
+// FormatMXN formats a price in Mexican pesos for the locale.
+func FormatMXN(l Lang, amount float64) string {
+	return FormatNumber(l, amount, 2) + " MXN"
+}
@@ -0,0 +1,140 @@
+package i18n
+
+// Key names a canned message.
+type Key int
+
+const (
+	Refuse Key = iota
+	Escalate
+	Handoff
+	OutOfScope
+	KavakInfoHeader
+	RecommendationsHeader
+	RecommendationLine
+	SwitchLanguage
+	PhotoQuery
+	PhotoNotCar
+	PhotoUnreadable
+	MediaTooLarge
+	MediaUnsupported
+	AudioUnreadable
+	QuoteLink
+	WelcomeBack
+	WelcomeBackCar
+	LastCarHeader
+	ProfileNote
+	ProfileView
+	ProfileEmpty
+	ProfileDeleted
+	ProfileBudget
+	ProfileMonthlyBudget
+	ProfileMakes
+	ProfileBodyTypes
+	ProfileFamilySize
+	ProfileCity
+	ProfileFinancing
+)
+
+var messages = map[Lang]map[Key]string{
+	Spanish: {
+		Refuse:                "Lo siento, no puedo ayudarte con eso 😊. Con gusto te apoyo con información de Kavak, autos o financiamiento.",
+		Escalate:              "Gracias por tu mensaje. Voy a canalizar tu conversación con uno de nuestros asesores, quien te contactará en breve 😊.",
+		Handoff:               "¡Claro! Voy a pedirle a uno de nuestros asesores que continúe contigo; te contactará en breve por este medio 😊.",
+		OutOfScope:            "¡Vaya, esa pregunta está fuera de mi alcance! Pero con gusto puedo ayudarte con temas de Kavak, autos o financiamiento 😊.",
+		KavakInfoHeader:       "Información de Kavak (propuesta de valor y sucursales):",
+		RecommendationsHeader: "Nuevas recomendaciones (top-%d) basadas en tu mensaje:",
+		RecommendationLine:    "%d) %s %s %s (%d) – Precio: %s, Kilometraje: %s km",
+		SwitchLanguage:        "El usuario ahora escribe en %s. Responde en %s a partir de ahora.",
+		PhotoQuery:            "Busco un auto como el de mi foto: %s",
+		PhotoNotCar:           "¡Gracias por la foto! No logré reconocer un auto en ella 🤔. ¿Me cuentas qué marca, modelo o tipo de auto buscas?",
+		PhotoUnreadable:       "No pude abrir tu foto 😅. ¿Puedes enviarla de nuevo o describirme el auto que buscas?",
+		MediaTooLarge:         "El archivo es demasiado grande (máximo %d MB). ¿Puedes enviar uno más ligero o escribirme tu mensaje?",
+		MediaUnsupported:      "Por ahora solo puedo leer texto, notas de voz y fotos de autos 😊. ¿Me escribes tu mensaje?",
+		AudioUnreadable:       "No logré escuchar bien tu nota de voz 😅. ¿Puedes enviarla de nuevo o escribirme tu mensaje?",
+		QuoteLink:             "📄 Consulta tu cotización con la tabla de pagos mes a mes aquí: %s",
+		WelcomeBack:           "El usuario regresa después de que su conversación anterior terminó. Empieza tu respuesta con «¡Hola de nuevo!».",
+		WelcomeBackCar:        "La última vez vio el %s %s %s (%d); menciónalo y pregúntale si le sigue interesando.",
+		LastCarHeader:         "Último auto recomendado:",
+		ProfileNote:           "Lo que el cliente contó en conversaciones anteriores: %s. Úsalo para orientar tus recomendaciones sin volver a preguntarlo, pero confírmalo si parece haber cambiado.",
+		ProfileView:           "Esto es lo que recuerdo de nuestras conversaciones:\n%s\n\nSi quieres que lo olvide, escribe «borrar mis datos».",
+		ProfileEmpty:          "No tengo nada guardado sobre ti de conversaciones anteriores.",
+		ProfileDeleted:        "Listo, borré lo que recordaba de ti y esta conversación; empezamos de cero.",
+		ProfileBudget:         "Presupuesto: hasta %s",
+		ProfileMonthlyBudget:  "Mensualidad: hasta %s",
+		ProfileMakes:          "Marcas: %s",
+		ProfileBodyTypes:      "Tipo de auto: %s",
+		ProfileFamilySize:     "Familia de %d",
+		ProfileCity:           "Ciudad: %s",
+		ProfileFinancing:      "Interés en financiamiento",
+	},
+	English: {
+		Refuse:                "Sorry, I can't help with that 😊. I'm happy to help with Kavak information, cars or financing.",
+		Escalate:              "Thanks for your message. I'm passing your conversation to one of our advisors, who will contact you shortly 😊.",
+		Handoff:               "Of course! I'll ask one of our advisors to continue with you; they'll contact you here shortly 😊.",
+		OutOfScope:            "That question is outside what I can help with! But I'm happy to help with Kavak, cars or financing 😊.",
+		KavakInfoHeader:       "Kavak information (value proposition and branches):",
+		RecommendationsHeader: "New recommendations (top-%d) based on your message:",
+		RecommendationLine:    "%d) %s %s %s (%d) – Price: %s, Mileage: %s km",
+		SwitchLanguage:        "El usuario ahora escribe en %s. Responde en %s a partir de ahora.",
+		PhotoQuery:            "I'm looking for a car like the one in my photo: %s",
+		PhotoNotCar:           "Thanks for the photo! I couldn't spot a car in it 🤔. Could you tell me the make, model or type of car you're looking for?",
+		PhotoUnreadable:       "I couldn't open your photo 😅. Could you send it again or describe the car you're looking for?",
+		MediaTooLarge:         "The file is too large (max %d MB). Could you send a lighter one or type your message?",
+		MediaUnsupported:      "For now I can only read text, voice notes and photos of cars 😊. Could you type your message?",
+		AudioUnreadable:       "I couldn't make out your voice note 😅. Could you send it again or type your message?",
+		QuoteLink:             "📄 See your quote with the month-by-month payment table here: %s",
+		WelcomeBack:           "El usuario regresa después de que su conversación anterior terminó. Empieza tu respuesta con «Welcome back!».",
+		WelcomeBackCar:        "La última vez vio el %s %s %s (%d); menciónalo y pregúntale si le sigue interesando.",
+		LastCarHeader:         "Último auto recomendado (last recommended car):",
+		ProfileNote:           "Lo que el cliente contó en conversaciones anteriores: %s. Úsalo para orientar tus recomendaciones sin volver a preguntarlo, pero confírmalo si parece haber cambiado.",
+		ProfileView:           "This is what I remember from our conversations:\n%s\n\nIf you want me to forget it, write “delete my data”.",
+		ProfileEmpty:          "I don't have anything saved about you from previous conversations.",
+		ProfileDeleted:        "Done, I deleted what I remembered about you and this conversation; we're starting over.",
+		ProfileBudget:         "Budget: up to %s",
+		ProfileMonthlyBudget:  "Monthly payment: up to %s",
+		ProfileMakes:          "Makes: %s",
+		ProfileBodyTypes:      "Body type: %s",
+		ProfileFamilySize:     "Family of %d",
+		ProfileCity:           "City: %s",
+		ProfileFinancing:      "Interested in financing",
+	},
+	Portuguese: {
+		Refuse:                "Desculpe, não posso ajudar com isso 😊. Posso ajudar com informações da Kavak, carros ou financiamento.",
+		Escalate:              "Obrigado pela sua mensagem. Vou encaminhar sua conversa para um dos nossos consultores, que entrará em contato em breve 😊.",
+		Handoff:               "Claro! Vou pedir para um dos nossos consultores continuar com você; ele entrará em contato por aqui em breve 😊.",
+		OutOfScope:            "Essa pergunta está fora do meu alcance! Mas posso ajudar com a Kavak, carros ou financiamento 😊.",
+		KavakInfoHeader:       "Informações da Kavak (proposta de valor e filiais):",
+		RecommendationsHeader: "Novas recomendações (top-%d) com base na sua mensagem:",
+		RecommendationLine:    "%d) %s %s %s (%d) – Preço: %s, Quilometragem: %s km",
+		SwitchLanguage:        "El usuario ahora escribe en %s. Responde en %s a partir de ahora.",
+		PhotoQuery:            "Procuro um carro como o da minha foto: %s",
+		PhotoNotCar:           "Obrigado pela foto! Não consegui reconhecer um carro nela 🤔. Pode me dizer a marca, o modelo ou o tipo de carro que procura?",
+		PhotoUnreadable:       "Não consegui abrir sua foto 😅. Pode enviá-la de novo ou descrever o carro que procura?",
+		MediaTooLarge:         "O arquivo é grande demais (máximo %d MB). Pode enviar um mais leve ou escrever sua mensagem?",
+		MediaUnsupported:      "Por enquanto só consigo ler texto, mensagens de voz e fotos de carros 😊. Pode escrever sua mensagem?",
+		AudioUnreadable:       "Não consegui entender sua mensagem de voz 😅. Pode enviá-la de novo ou escrever sua mensagem?",
+		QuoteLink:             "📄 Veja sua cotação com a tabela de parcelas mês a mês aqui: %s",
+		WelcomeBack:           "El usuario regresa después de que su conversación anterior terminó. Empieza tu respuesta con «Olá de novo!».",
+		WelcomeBackCar:        "La última vez vio el %s %s %s (%d); menciónalo y pregúntale si le sigue interesando.",
+		LastCarHeader:         "Último auto recomendado (último carro recomendado):",
+		ProfileNote:           "Lo que el cliente contó en conversaciones anteriores: %s. Úsalo para orientar tus recomendaciones sin volver a preguntarlo, pero confírmalo si parece haber cambiado.",
+		ProfileView:           "Isto é o que lembro das nossas conversas:\n%s\n\nSe quiser que eu esqueça, escreva «apagar meus dados».",
+		ProfileEmpty:          "Não tenho nada salvo sobre você de conversas anteriores.",
+		ProfileDeleted:        "Pronto, apaguei o que lembrava de você e esta conversa; vamos começar do zero.",
+		ProfileBudget:         "Orçamento: até %s",
+		ProfileMonthlyBudget:  "Parcela: até %s",
+		ProfileMakes:          "Marcas: %s",
+		ProfileBodyTypes:      "Tipo de carro: %s",
+		ProfileFamilySize:     "Família de %d",
+		ProfileCity:           "Cidade: %s",
+		ProfileFinancing:      "Interesse em financiamento",
+	},
+}
+
+// Message returns the canned message key in l, falling back to Spanish.
+func Message(l Lang, key Key) string {
+	if m, ok := messages[l][key]; ok {
+		return m
+	}
+	return messages[Default][key]
+}
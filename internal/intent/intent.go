@@ -0,0 +1,154 @@
+package intent
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/llm"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+)
+
+type Intent string
+
+const (
+	Greeting      Intent = "greeting"
+	KavakInfo     Intent = "kavak_info"
+	CatalogSearch Intent = "catalog_search"
+	PriceQuestion Intent = "price_question"
+	TradeIn       Intent = "trade_in"
+	Compare       Intent = "compare"
+	Financing     Intent = "financing"
+	Affordability Intent = "affordability"
+	Handoff       Intent = "handoff"
+	OutOfScope    Intent = "out_of_scope"
+)
+
+var all = []Intent{Greeting, KavakInfo, CatalogSearch, PriceQuestion, TradeIn, Compare, Affordability, Financing, Handoff, OutOfScope}
+
+// NeedsSearch reports whether the catalog should be searched for the message.
+func (i Intent) NeedsSearch() bool {
+	return i == CatalogSearch || i == Affordability
+}
+
+// SessionIndependent reports whether the answer depends only on the message,
+// not on what was said earlier in the session.
+func (i Intent) SessionIndependent() bool {
+	return i == KavakInfo
+}
+
+var (
+	handoffRe   = regexp.MustCompile(`\b(asesor(a|es)?|agente humano|persona real|un humano|hablar con alguien|ejecutiv[oa]|vendedor(a)?|llam(a|e)me|marquenme|contactenme|advisor|salesperson|human|real person|consultor(a|es)?|atendente|falar com alguem)\b`)
+	tradeInRe   = regexp.MustCompile(`\b(a cuenta|toma de (mi )?(auto|carro|coche)|(vender|dar|dejar|entregar) (mi|el) (auto|carro|coche)|cuanto (me dan|dan|vale|me darian) por mi (auto|carro|coche)|trade.?in|sell my car|my (current )?car as|na troca|(vender|dar|avaliar) (o )?meu carro|quanto vale (o )?meu carro)\b`)
+	compareRe   = regexp.MustCompile(`\b(compar\w*|cual (es|seria) mejor|cual me conviene( mas)?|diferencias? entre|vs|versus|which (one )?is better|difference between|qual (e|seria) melhor|diferencas? entre)\b`)
+	perMonthRe  = regexp.MustCompile(`\b(al mes|por mes|mensual(es|idad|idades)?|a month|per month|monthly|mensais|mensal|parcelas?)\b`)
+	affordRe    = regexp.MustCompile(`\b(que (autos? |carros? |coches? )?(puedo|podria) (comprar|adquirir|pagar)|me alcanza|alcanzaria|afford|what can i (buy|get)|which cars? can i|o que (posso|da para) comprar|que carros? posso|cabe no (meu )?bolso|busco|recomienda\w*|muestrame|looking for|recommend\w*|show me|procuro)\b`)
+	financingRe = regexp.MustCompile(`\b(enganche|financ\w*|mensualidad(es)?|pago mensual|pagos? mensuales|credito|plazo|tasa|intereses|meses sin intereses|\d+ (anos|meses)|down payment|monthly payments?|loan|interest rate|installments?|entrada|parcelas?|juros|\d+ (years|months))\b`)
+	priceRe     = regexp.MustCompile(`\b(precio|cuanto (cuesta|vale|sale|esta)|en cuanto|costo|cuesta|price|how much|cost|costs|preco|quanto (custa|sai)|custa)\b`)
+	catalogRe   = regexp.MustCompile(`\b(tienen|tienes|hay|busco|buscando|quiero|quisiera|recomienda\w*|muestrame|ensename|opcion(es)?|otr[oa]s?|distint[oa]|diferente|suvs?|sedan(es)?|hatchbacks?|camionetas?|pickups?|autos?|carros?|coches?|vehiculos?|familiar|menos de|hasta|presupuesto|modelo|marca|kilometraje|automatic[oa]|estandar|compar\w*|looking for|show me|recommend\w*|options?|other|cars?|trucks?|vehicles?|budget|under|procuro|procurando|mostre|opcoes|outros?|veiculos?|orcamento)\b`)
+	referenceRe = regexp.MustCompile(`\b(es[eao]s?|este|esta|estos|estas|el (primero|segundo|tercero|ultimo)|la (primera|segunda|tercera|ultima)|this one|that one|the (first|second|third|last) one|esse|essa|aquele|o (primeiro|segundo|terceiro|ultimo))\b`)
+	infoRe      = regexp.MustCompile(`\b(que es kavak|sucursal(es)?|sedes?|horarios?|ubicacion(es)?|direccion(es)?|donde estan|garantia|inspeccion|certificad[oa]s?|como funciona|proceso|entrega|devolucion|documentos|requisitos|propuesta de valor|beneficios|what is kavak|branch(es)?|opening hours|warranty|inspection|how does it work|o que e a kavak|filia(l|is)|horario de funcionamento|garantia|inspecao|como funciona)\b`)
+	greetingRe  = regexp.MustCompile(`\b(hola|buen(os|as)? (dias|tardes|noches)|buen dia|que tal|como estas|gracias|muchas gracias|adios|hasta luego|saludos|ok|vale|perfecto|hello|hi|hey|good (morning|afternoon|evening)|thanks|thank you|bye|ola|oi|bom dia|boa (tarde|noite)|obrigad[oa]|tchau)\b|👍`)
+	makeRe      = regexp.MustCompile(`\b(audi|bmw|chevrolet|dodge|fiat|ford|honda|infiniti|jac|jeep|kia|land rover|lincoln|mazda|mercedes|mg|mini|nissan|peugeot|renault|seat|suzuki|toyota|volkswagen|vw|volvo|hyundai|tesla|porsche)\b`)
+	accents     = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n", "ã", "a", "â", "a", "à", "a", "ê", "e", "ô", "o", "õ", "o", "ç", "c", "¿", " ", "?", " ", "¡", " ", "!", " ")
+)
+
+// Rules classifies text with keyword rules. It returns false when no rule
+// is confident.
+func Rules(text string) (Intent, bool) {
+	t := accents.Replace(strings.ToLower(text))
+	catalogCue := catalogRe.MatchString(t) || makeRe.MatchString(t)
+
+	switch {
+	case handoffRe.MatchString(t):
+		return Handoff, true
+	case tradeInRe.MatchString(t):
+		return TradeIn, true
+	case compareRe.MatchString(t):
+		return Compare, true
+	case perMonthRe.MatchString(t) && affordRe.MatchString(t) && !referenceRe.MatchString(t):
+		return Affordability, true
+	case financingRe.MatchString(t):
+		return Financing, true
+	case priceRe.MatchString(t) && (referenceRe.MatchString(t) || !catalogCue):
+		return PriceQuestion, true
+	case infoRe.MatchString(t):
+		return KavakInfo, true
+	case catalogCue:
+		return CatalogSearch, true
+	case strings.Contains(t, "kavak"):
+		return KavakInfo, true
+	case greetingRe.MatchString(t) && len(strings.Fields(t)) <= 6:
+		return Greeting, true
+	}
+	return "", false
+}
+
+const classifierPrompt = `Clasifica el mensaje de un cliente de Kavak (compra-venta de autos seminuevos en México) en exactamente una de estas intenciones y responde solo con la etiqueta:
+greeting: saludo, agradecimiento o despedida
+kavak_info: información general de Kavak, sucursales, horarios, garantía, procesos
+catalog_search: busca autos, pide recomendaciones u otras opciones
+price_question: pregunta el precio de un auto ya mencionado
+trade_in: quiere dejar su auto actual a cuenta o saber cuánto le dan por él
+compare: quiere comparar dos o más autos o saber cuál le conviene
+affordability: pregunta qué autos puede comprar con cierta mensualidad
+financing: enganche, mensualidades, plazos, crédito
+handoff: quiere hablar con un asesor humano
+out_of_scope: no tiene que ver con Kavak ni con autos`
+
+// Classifier runs the rules and, when they aren't confident, optionally asks
+// the LLM. Without the LLM fallback unknown messages are treated as catalog
+// searches, which is what every message used to be.
+type Classifier struct {
+	client *llm.Client
+	model  string
+}
+
+// NewClassifier returns a rules-only classifier when client is nil.
+func NewClassifier(cfg config.IntentConfig, client *llm.Client) *Classifier {
+	c := &Classifier{model: cfg.Model}
+	if c.model == "" {
+		c.model = llm.DefaultModel
+	}
+	if cfg.LLMFallback {
+		c.client = client
+	}
+	return c
+}
+
+func (c *Classifier) Classify(ctx context.Context, text string) Intent {
+	if i, ok := Rules(text); ok {
+		metrics.IntentClassifications.WithLabelValues(string(i), "rules").Inc()
+		return i
+	}
+
+	if c.client != nil {
+		answer, err := c.client.Chat(ctx, c.model, []openai.ChatCompletionMessage{
+			{Role: "system", Content: classifierPrompt},
+			{Role: "user", Content: text},
+		})
+		if err != nil {
+			log.Printf("intent: LLM fallback failed: %v", err)
+		} else if i, ok := parse(answer); ok {
+			metrics.IntentClassifications.WithLabelValues(string(i), "llm").Inc()
+			return i
+		}
+	}
+
+	metrics.IntentClassifications.WithLabelValues(string(CatalogSearch), "default").Inc()
+	return CatalogSearch
+}
+
+func parse(answer string) (Intent, bool) {
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	for _, i := range all {
+		if strings.Contains(answer, string(i)) {
+			return i, true
+		}
+	}
+	return "", false
+}
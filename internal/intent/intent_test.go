@@ -0,0 +1,38 @@
+package intent
+
+import "testing"
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		text string
+		want Intent
+	}{
+		{"Hola", Greeting},
+		{"ok, vale", Greeting},
+		{"Vale, gracias", Greeting},
+		{"perfecto, muchas gracias 👍", Greeting},
+		{"thanks!", Greeting},
+		{"¿Cuánto vale el segundo?", PriceQuestion},
+		{"vale, ¿y cuánto cuesta ese?", PriceQuestion},
+		{"what's the price of that one?", PriceQuestion},
+		{"quanto custa esse?", PriceQuestion},
+		{"¿Qué SUV tienen?", CatalogSearch},
+		{"busco un Mazda de menos de 300 mil", CatalogSearch},
+		{"quiero el segundo", CatalogSearch},
+		{"¿Dónde están sus sucursales?", KavakInfo},
+		{"¿Qué es Kavak?", KavakInfo},
+		{"Si te doy 100000 de enganche, ¿cómo quedaría el financiamiento?", Financing},
+		{"¿Qué autos puedo comprar con 6,000 al mes?", Affordability},
+		{"¿cuál es mejor, el Mazda 3 o el Jetta?", Compare},
+		{"¿Cuánto me dan por mi auto?", TradeIn},
+		{"quiero hablar con un asesor", Handoff},
+	}
+	for _, tt := range tests {
+		if got, _ := Rules(tt.text); got != tt.want {
+			t.Errorf("Rules(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+	if got, ok := Rules("¿Dónde queda Starbucks?"); ok {
+		t.Errorf("Rules classified an unrelated question as %q", got)
+	}
+}
@@ -1,12 +1,22 @@
 package llm
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/sashabaranov/go-openai"
+
+	"carlospayan/agent-comercial-ai/internal/usage"
 )
 
+// DefaultModel is used when no model is configured.
+const DefaultModel = "gpt-3.5-turbo"
+
 type Client struct {
 	api *openai.Client
 }
@@ -15,12 +25,18 @@ func NewClient(apiKey string) *Client {
 	return &Client{api: openai.NewClient(apiKey)}
 }
 
+// NewClientConfig returns a client with a custom OpenAI config, such as
+// another base URL.
+func NewClientConfig(cfg openai.ClientConfig) *Client {
+	return &Client{api: openai.NewClientWithConfig(cfg)}
+}
+
 func (c *Client) Ask(ctx context.Context, prompt string) (string, error) {
 	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 
 	resp, err := c.api.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model: "gpt-3.5-turbo",
+		Model: DefaultModel,
 		Messages: []openai.ChatCompletionMessage{
 			{Role: "system", Content: "Eres un agente comercial de Kavak. Responde con base en la información proporcionada."},
 			{Role: "user", Content: prompt},
@@ -30,22 +46,181 @@ func (c *Client) Ask(ctx context.Context, prompt string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	usage.Record(ctx, DefaultModel, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+	return resp.Choices[0].Message.Content, nil
+}
+
+func (c *Client) Chat(ctx context.Context, model string, messages []openai.ChatCompletionMessage) (string, error) {
+	return c.ChatFormat(ctx, model, messages, nil)
+}
+
+// ChatFormat is Chat with a response format, used to ask for JSON answers.
+// A nil format means plain text.
+func (c *Client) ChatFormat(ctx context.Context, model string, messages []openai.ChatCompletionMessage, format *openai.ChatCompletionResponseFormat) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	req := openai.ChatCompletionRequest{
+		Model:          model,
+		Messages:       messages,
+		MaxTokens:      300,
+		ResponseFormat: format,
+	}
+
+	resp, err := c.api.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	usage.Record(ctx, model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
 	return resp.Choices[0].Message.Content, nil
 }
 
-func (c *Client) Chat(ctx context.Context, messages []openai.ChatCompletionMessage) (string, error) {
+// ChatTools is Chat with tools the model may call. choice selects a tool to
+// force, or is empty to let the model decide. The returned message holds
+// either the answer or the tool calls.
+func (c *Client) ChatTools(ctx context.Context, model string, messages []openai.ChatCompletionMessage, tools []openai.Tool, choice string) (openai.ChatCompletionMessage, error) {
 	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 
 	req := openai.ChatCompletionRequest{
-		Model:     "gpt-3.5-turbo",
+		Model:     model,
 		Messages:  messages,
 		MaxTokens: 300,
+		Tools:     tools,
+	}
+	if choice != "" {
+		req.ToolChoice = openai.ToolChoice{
+			Type:     openai.ToolTypeFunction,
+			Function: openai.ToolFunction{Name: choice},
+		}
 	}
 
 	resp, err := c.api.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	usage.Record(ctx, model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+	return resp.Choices[0].Message, nil
+}
+
+func (c *Client) ChatStream(ctx context.Context, model string, messages []openai.ChatCompletionMessage, onDelta func(string) error) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	req := openai.ChatCompletionRequest{
+		Model:     model,
+		Messages:  messages,
+		MaxTokens: 300,
+		Stream:    true,
+		StreamOptions: &openai.StreamOptions{
+			IncludeUsage: true,
+		},
+	}
+
+	stream, err := c.api.CreateChatCompletionStream(ctx, req)
 	if err != nil {
 		return "", err
 	}
+	defer stream.Close()
+
+	var answer strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return answer.String(), nil
+		}
+		if err != nil {
+			return answer.String(), err
+		}
+		if resp.Usage != nil {
+			usage.Record(ctx, model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+		delta := resp.Choices[0].Delta.Content
+		if delta == "" {
+			continue
+		}
+		answer.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			return answer.String(), err
+		}
+	}
+}
+
+// Vision asks model, which must accept images, about an image and returns
+// its answer as JSON.
+func (c *Client) Vision(ctx context.Context, model, prompt string, image []byte, contentType string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	dataURL := "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(image)
+	resp, err := c.api.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{{
+			Role: "user",
+			MultiContent: []openai.ChatMessagePart{
+				{Type: openai.ChatMessagePartTypeText, Text: prompt},
+				{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{
+					URL:    dataURL,
+					Detail: openai.ImageURLDetailLow,
+				}},
+			},
+		}},
+		MaxTokens:      200,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return "", err
+	}
+	usage.Record(ctx, model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
 	return resp.Choices[0].Message.Content, nil
 }
+
+// Transcribe turns speech into text with an OpenAI transcription model.
+// filename only tells the API the audio format. An empty language lets the
+// model detect it. Whisper models are asked for the verbose format, the only
+// one that reports the audio duration they are charged by; the duration of
+// other models is recorded as 0.
+func (c *Client) Transcribe(ctx context.Context, model, language string, audio []byte, filename string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	format := openai.AudioResponseFormatJSON
+	if strings.HasPrefix(model, "whisper") {
+		format = openai.AudioResponseFormatVerboseJSON
+	}
+	resp, err := c.api.CreateTranscription(ctx, openai.AudioRequest{
+		Model:    model,
+		FilePath: filename,
+		Reader:   bytes.NewReader(audio),
+		Language: language,
+		Format:   format,
+	})
+	if err != nil {
+		return "", err
+	}
+	usage.RecordAudio(ctx, model, resp.Duration)
+	return resp.Text, nil
+}
+
+// Moderate reports whether OpenAI's moderation model flags text.
+func (c *Client) Moderate(ctx context.Context, text string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := c.api.Moderations(ctx, openai.ModerationRequest{
+		Input: text,
+		Model: openai.ModerationOmniLatest,
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, result := range resp.Results {
+		if result.Flagged {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,162 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+)
+
+const (
+	defaultMaxBytes = 5 << 20
+	defaultTimeout  = 10 * time.Second
+)
+
+var (
+	// ErrTooLarge is returned for files over the configured size limit.
+	ErrTooLarge = errors.New("media file too large")
+	// ErrHost is returned for URLs outside Twilio's media hosts.
+	ErrHost = errors.New("media URL not hosted by Twilio")
+)
+
+// File is a downloaded media file.
+type File struct {
+	Data        []byte
+	ContentType string
+}
+
+// Fetcher downloads the media Twilio attaches to WhatsApp messages
+// (MediaUrl0...) with the account credentials. URLs of other hosts, such as
+// the local stand-in server, are only fetched, without credentials, when
+// the config allows any host.
+type Fetcher struct {
+	client       *http.Client
+	maxBytes     int64
+	accountSID   string
+	authToken    string
+	allowAnyHost bool
+}
+
+func NewFetcher(cfg config.MediaConfig, twilio config.TwilioConfig) *Fetcher {
+	maxBytes := cfg.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Fetcher{
+		client:       &http.Client{Timeout: timeout},
+		maxBytes:     maxBytes,
+		accountSID:   twilio.AccountSID,
+		authToken:    twilio.AuthToken,
+		allowAnyHost: cfg.AllowAnyHost,
+	}
+}
+
+// MaxBytes is the size limit of downloads.
+func (f *Fetcher) MaxBytes() int64 {
+	return f.maxBytes
+}
+
+// Fetch downloads url. contentType is the type Twilio reported for it and is
+// used when the response doesn't say.
+func (f *Fetcher) Fetch(ctx context.Context, url, contentType string) (File, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return File{}, fmt.Errorf("error building media request: %w", err)
+	}
+	switch {
+	case isTwilio(req.URL):
+		if f.accountSID != "" {
+			req.SetBasicAuth(f.accountSID, f.authToken)
+		}
+	case !f.allowAnyHost:
+		return File{}, fmt.Errorf("%w: %s", ErrHost, req.URL.Host)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return File{}, fmt.Errorf("error downloading media: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return File{}, fmt.Errorf("error downloading media: status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > f.maxBytes {
+		return File{}, ErrTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return File{}, fmt.Errorf("error reading media: %w", err)
+	}
+	if int64(len(data)) > f.maxBytes {
+		return File{}, ErrTooLarge
+	}
+
+	if t := resp.Header.Get("Content-Type"); t != "" && t != "application/octet-stream" {
+		contentType = t
+	}
+	return File{Data: data, ContentType: baseType(contentType)}, nil
+}
+
+// isTwilio reports whether u is served by Twilio over HTTPS, the only URLs
+// the account credentials are sent to.
+func isTwilio(u *url.URL) bool {
+	host := u.Hostname()
+	return u.Scheme == "https" && (host == "api.twilio.com" || strings.HasSuffix(host, ".twilio.com"))
+}
+
+// IsImage reports whether contentType is an image the vision model reads.
+func IsImage(contentType string) bool {
+	switch baseType(contentType) {
+	case "image/jpeg", "image/png", "image/webp", "image/gif":
+		return true
+	}
+	return false
+}
+
+// IsAudio reports whether contentType is audio, such as a voice note.
+func IsAudio(contentType string) bool {
+	return strings.HasPrefix(baseType(contentType), "audio/")
+}
+
+// Filename returns a file name whose extension matches contentType, for APIs
+// that tell formats apart by extension.
+func Filename(name, contentType string) string {
+	switch baseType(contentType) {
+	case "audio/ogg", "audio/opus":
+		return name + ".ogg"
+	case "audio/mpeg":
+		return name + ".mp3"
+	case "audio/mp4", "audio/aac", "audio/x-m4a":
+		return name + ".m4a"
+	case "audio/wav", "audio/x-wav":
+		return name + ".wav"
+	case "audio/webm":
+		return name + ".webm"
+	case "audio/amr":
+		return name + ".amr"
+	}
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		return name + exts[0]
+	}
+	return name
+}
+
+func baseType(contentType string) string {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return t
+}
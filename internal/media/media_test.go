@@ -0,0 +1,64 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+)
+
+func TestIsTwilio(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://api.twilio.com/2010-04-01/Accounts/AC1/Messages/MM1/Media/ME1", true},
+		{"https://media.twiliocdn.twilio.com/x", true},
+		{"http://api.twilio.com/x", false},
+		{"https://twilio.com.attacker.tld/x", false},
+		{"https://eviltwilio.com/x", false},
+		{"https://api.twilio.com.evil.tld/x", false},
+		{"https://attacker.tld/?twilio.com", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isTwilio(u); got != tt.want {
+			t.Errorf("isTwilio(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestFetchOtherHosts(t *testing.T) {
+	var auth bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, auth = r.BasicAuth()
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("jpeg"))
+	}))
+	defer server.Close()
+	twilio := config.TwilioConfig{AccountSID: "AC1", AuthToken: "secret"}
+
+	f := NewFetcher(config.MediaConfig{}, twilio)
+	if _, err := f.Fetch(context.Background(), server.URL+"/photo.jpg", ""); !errors.Is(err, ErrHost) {
+		t.Errorf("Fetch of another host = %v, want ErrHost", err)
+	}
+
+	f = NewFetcher(config.MediaConfig{AllowAnyHost: true}, twilio)
+	file, err := f.Fetch(context.Background(), server.URL+"/photo.jpg", "")
+	if err != nil {
+		t.Fatalf("Fetch with any host allowed: %v", err)
+	}
+	if file.ContentType != "image/jpeg" || string(file.Data) != "jpeg" {
+		t.Errorf("fetched %+v", file)
+	}
+	if auth {
+		t.Errorf("sent the Twilio credentials to another host")
+	}
+}
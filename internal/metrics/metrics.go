@@ -28,8 +28,109 @@ var (
 		Help:    "Time for (ms)  handler /whatsapp",
 		Buckets: prometheus.ExponentialBuckets(100, 2, 8),
 	})
+
+	StreamHandlerLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "chat_stream_latency_ms",
+		Help:    "Time for (ms)  handler /v1/chat/stream",
+		Buckets: prometheus.ExponentialBuckets(100, 2, 8),
+	})
+
+	ConversationTurns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "conversation_turns_total",
+		Help: "Answered user messages by endpoint, prompt version, experiment variant and intent",
+	}, []string{"endpoint", "prompt_version", "variant", "intent"})
+
+	ExperimentSessions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "experiment_sessions_total",
+		Help: "New sessions assigned to each experiment variant",
+	}, []string{"experiment", "variant"})
+
+	GroundingViolations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grounding_violations_total",
+		Help: "Invented cars or wrong prices found in LLM answers",
+	}, []string{"kind", "action"})
+
+	GuardDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "guard_decisions_total",
+		Help: "Input guard decisions by rule",
+	}, []string{"rule", "decision"})
+
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "response_cache_lookups_total",
+		Help: "Response cache lookups by result (hit, miss, skip)",
+	}, []string{"result"})
+
+	CacheEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "response_cache_entries",
+		Help: "Answers currently held by the response cache",
+	})
+
+	IntentClassifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "intent_classifications_total",
+		Help: "Classified user messages by intent and source (rules, llm, default)",
+	}, []string{"intent", "source"})
+
+	StructuredOutputs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "structured_outputs_total",
+		Help: "Structured LLM answers by result (ok, invalid, fallback)",
+	}, []string{"result"})
+
+	ChatHandlerLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "chat_latency_ms",
+		Help:    "Time for (ms)  handler /v1/chat",
+		Buckets: prometheus.ExponentialBuckets(100, 2, 8),
+	})
+
+	PromptTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "openai_prompt_tokens_total",
+		Help: "Prompt tokens sent to OpenAI",
+	}, []string{"model", "endpoint"})
+
+	CompletionTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "openai_completion_tokens_total",
+		Help: "Completion tokens returned by OpenAI",
+	}, []string{"model", "endpoint"})
+
+	AudioSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "openai_audio_seconds_total",
+		Help: "Seconds of audio transcribed by OpenAI",
+	}, []string{"model", "endpoint"})
+
+	EstimatedCostUSD = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "openai_estimated_cost_usd_total",
+		Help: "Estimated OpenAI cost (USD) from the configured price table",
+	}, []string{"model", "endpoint"})
+
+	CritiqueChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "answer_critiques_total",
+		Help: "Second-pass checks of LLM answers by intent and result (ok, skipped, regenerated, rewritten)",
+	}, []string{"intent", "result"})
+
+	CritiqueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "answer_critique_latency_ms",
+		Help:    "Time (ms) added to a turn by the second-pass check, including regeneration",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"intent"})
+
+	MediaMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "whatsapp_media_messages_total",
+		Help: "WhatsApp media messages by kind (image, audio, other) and result (ok, not_car, empty, too_large, error, unsupported)",
+	}, []string{"kind", "result"})
+
+	TranscriptionLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "voice_note_transcription_latency_ms",
+		Help:    "Time (ms) to transcribe a WhatsApp voice note",
+		Buckets: prometheus.ExponentialBuckets(100, 2, 8),
+	})
+
+	SessionsExpired = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sessions_expired_total",
+		Help: "Conversations ended by expiry, by where it was noticed (janitor, returning)",
+	}, []string{"source"})
 )
 
 func init() {
-	prometheus.MustRegister(CatLatency, LLMLatency, QAHandlerLatency, WhatsappHandlerLatency)
+	prometheus.MustRegister(CatLatency, LLMLatency, QAHandlerLatency, WhatsappHandlerLatency, StreamHandlerLatency,
+		ConversationTurns, ExperimentSessions, GroundingViolations, GuardDecisions, CacheLookups, CacheEntries, IntentClassifications, StructuredOutputs, ChatHandlerLatency, PromptTokens, CompletionTokens, AudioSeconds, EstimatedCostUSD,
+		CritiqueChecks, CritiqueLatency, MediaMessages, TranscriptionLatency, SessionsExpired)
 }
@@ -0,0 +1,137 @@
+package prompts
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+)
+
+// Data is what system prompt templates can reference.
+type Data struct {
+	KavakInfoURL string
+	Branches     []config.BranchConfig
+	Financing    config.FinancingConfig
+}
+
+// Library holds every rendered version of the system prompt found in the
+// prompts directory. Files are named system_<version>.tmpl for the Spanish
+// prompt and system_<version>.<lang>.tmpl for its translations.
+type Library struct {
+	defaultVersion string
+	system         map[string]map[i18n.Lang]string
+}
+
+// funcs are the template functions. plan simulates a financing plan with
+// the configured rate, so worked examples in prompts always match the
+// numbers the financing package produces. It returns nil when the rules
+// allow no plan, so templates wrap examples in {{ with }} and a strict
+// financing config drops them instead of failing Load. money and amount
+// format numbers for lang, with and without cents.
+func funcs(calc *financing.Calculator, lang i18n.Lang) template.FuncMap {
+	return template.FuncMap{
+		"percent": func(rate float64) string {
+			return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", rate*100), "0"), ".") + "%"
+		},
+		"plan": func(price, downPayment float64, years int) *financing.Plan {
+			p, err := calc.Example(price, downPayment, years)
+			if err != nil {
+				log.Printf("prompts: financing example for %.2f skipped: %v", price, err)
+				return nil
+			}
+			return &p
+		},
+		"money": func(amount float64) string {
+			return i18n.FormatNumber(lang, amount, 2)
+		},
+		"amount": func(amount float64) string {
+			return i18n.FormatNumber(lang, amount, 0)
+		},
+	}
+}
+
+func Load(cfg config.PromptsConfig, data Data) (*Library, error) {
+	paths, err := filepath.Glob(filepath.Join(cfg.Dir, "system_*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing prompt templates: %w", err)
+	}
+
+	calc := financing.New(data.Financing)
+	lib := &Library{
+		defaultVersion: cfg.Version,
+		system:         make(map[string]map[i18n.Lang]string, len(paths)),
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "system_"), ".tmpl")
+		version, suffix, translated := strings.Cut(name, ".")
+		lang := i18n.Default
+		if translated {
+			var ok bool
+			if lang, ok = i18n.Parse(suffix); !ok {
+				return nil, fmt.Errorf("prompt %s: unknown language %q", path, suffix)
+			}
+		}
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading prompt %s: %w", path, err)
+		}
+		tmpl, err := template.New(name).Funcs(funcs(calc, lang)).Option("missingkey=error").Parse(string(raw))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing prompt %s: %w", path, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("error rendering prompt %s: %w", path, err)
+		}
+		if lib.system[version] == nil {
+			lib.system[version] = make(map[i18n.Lang]string)
+		}
+		lib.system[version][lang] = buf.String()
+	}
+
+	for version, langs := range lib.system {
+		if _, ok := langs[i18n.Default]; !ok {
+			return nil, fmt.Errorf("prompt version %q has no %s template", version, i18n.Default)
+		}
+	}
+	if _, ok := lib.system[lib.defaultVersion]; !ok {
+		return nil, fmt.Errorf("prompt version %q not found in %s", lib.defaultVersion, cfg.Dir)
+	}
+	return lib, nil
+}
+
+// Default returns the version selected in config.
+func (l *Library) Default() string {
+	return l.defaultVersion
+}
+
+// System returns the system prompt for version in lang, falling back to the
+// default version when it's unknown and to Spanish when it isn't translated.
+func (l *Library) System(version string, lang i18n.Lang) (string, string) {
+	langs, ok := l.system[version]
+	if !ok {
+		version, langs = l.defaultVersion, l.system[l.defaultVersion]
+	}
+	if prompt, ok := langs[lang]; ok {
+		return version, prompt
+	}
+	return version, langs[i18n.Default]
+}
+
+func (l *Library) Versions() []string {
+	versions := make([]string, 0, len(l.system))
+	for v := range l.system {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
@@ -0,0 +1,52 @@
+package prompts
+
+import (
+	"strings"
+	"testing"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+)
+
+var promptsConfig = config.PromptsConfig{Dir: "../../prompts", Version: "v1"}
+
+func financingConfig() config.FinancingConfig {
+	return config.FinancingConfig{AnnualRate: 0.169, MinYears: 3, MaxYears: 6, DefaultYears: 5, IVA: 0.16}
+}
+
+func TestLoadRendersFinancingExamples(t *testing.T) {
+	lib, err := Load(promptsConfig, Data{Financing: financingConfig()})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	_, prompt := lib.System("v1", i18n.Spanish)
+	for _, want := range []string{"Si te doy 100,000 de enganche", "📌 Enganche: 150,000 MXN"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt is missing %q", want)
+		}
+	}
+}
+
+func TestLoadSurvivesStrictFinancing(t *testing.T) {
+	// A minimum down payment above the examples' raises them to it.
+	cfg := financingConfig()
+	cfg.MinDownPayment = 0.5
+	lib, err := Load(promptsConfig, Data{Financing: cfg})
+	if err != nil {
+		t.Fatalf("Load with min_down_payment 0.5: %v", err)
+	}
+	_, prompt := lib.System("v1", i18n.Spanish)
+	if !strings.Contains(prompt, "📌 Enganche: 231,000 MXN") {
+		t.Errorf("Touareg example doesn't use the minimum down payment")
+	}
+
+	// No plan is possible at all: the examples are left out.
+	cfg.MinDownPayment = 1
+	lib, err = Load(promptsConfig, Data{Financing: cfg})
+	if err != nil {
+		t.Fatalf("Load with min_down_payment 1: %v", err)
+	}
+	if _, prompt := lib.System("v1", i18n.Spanish); strings.Contains(prompt, "Si te doy") || strings.Contains(prompt, "Supongamos que das") {
+		t.Errorf("prompt still has a financing example")
+	}
+}
@@ -0,0 +1,114 @@
+package speech
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/llm"
+	"carlospayan/agent-comercial-ai/internal/media"
+)
+
+const (
+	ProviderOpenAI = "openai"
+	ProviderLocal  = "local"
+
+	defaultModel = "whisper-1"
+)
+
+// Transcriber turns a voice note into text.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio media.File) (string, error)
+}
+
+// New returns the configured transcriber, or nil when voice notes are
+// disabled.
+func New(cfg config.SpeechConfig, client *llm.Client) Transcriber {
+	if !cfg.Enabled {
+		return nil
+	}
+	switch cfg.Provider {
+	case ProviderLocal:
+		return &Local{
+			url:      cfg.URL,
+			language: cfg.Language,
+			client:   &http.Client{Timeout: 60 * time.Second},
+		}
+	case ProviderOpenAI, "":
+	default:
+		log.Printf("speech: unknown provider %q, using %s", cfg.Provider, ProviderOpenAI)
+	}
+	model := cfg.Model
+	if model == "" {
+		model = defaultModel
+	}
+	return &Whisper{client: client, model: model, language: cfg.Language}
+}
+
+// Whisper transcribes with OpenAI's transcription API.
+type Whisper struct {
+	client   *llm.Client
+	model    string
+	language string
+}
+
+func (w *Whisper) Transcribe(ctx context.Context, audio media.File) (string, error) {
+	text, err := w.client.Transcribe(ctx, w.model, w.language, audio.Data, media.Filename("voice-note", audio.ContentType))
+	if err != nil {
+		return "", fmt.Errorf("error transcribing audio: %w", err)
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// Local transcribes with a self-hosted model behind the whisper.cpp server
+// API: a multipart POST with the audio in "file" that answers {"text": ...}.
+type Local struct {
+	url      string
+	language string
+	client   *http.Client
+}
+
+func (l *Local) Transcribe(ctx context.Context, audio media.File) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", media.Filename("voice-note", audio.ContentType))
+	if err != nil {
+		return "", fmt.Errorf("error building transcription request: %w", err)
+	}
+	part.Write(audio.Data)
+	form.WriteField("response_format", "json")
+	if l.language != "" {
+		form.WriteField("language", l.language)
+	}
+	form.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url, &body)
+	if err != nil {
+		return "", fmt.Errorf("error building transcription request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error transcribing audio: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error transcribing audio: status %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error reading transcription: %w", err)
+	}
+	return strings.TrimSpace(out.Text), nil
+}
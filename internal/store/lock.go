@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+// sessionLocks serializes the turns of each session within the process. A
+// session's entry lives while someone holds or waits for its lock.
+type sessionLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}
+
+type sessionLock struct {
+	// held has room for one token: sending takes the lock, receiving
+	// releases it, so that waiting can be canceled.
+	held  chan struct{}
+	users int
+}
+
+func newSessionLocks() *sessionLocks {
+	return &sessionLocks{locks: make(map[string]*sessionLock)}
+}
+
+func (l *sessionLocks) Lock(ctx context.Context, sessionID string) (func(), error) {
+	l.mu.Lock()
+	lock, ok := l.locks[sessionID]
+	if !ok {
+		lock = &sessionLock{held: make(chan struct{}, 1)}
+		l.locks[sessionID] = lock
+	}
+	lock.users++
+	l.mu.Unlock()
+
+	select {
+	case lock.held <- struct{}{}:
+	case <-ctx.Done():
+		l.release(sessionID, lock)
+		return nil, ctx.Err()
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-lock.held
+			l.release(sessionID, lock)
+		})
+	}, nil
+}
+
+func (l *sessionLocks) release(sessionID string, lock *sessionLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock.users--
+	if lock.users == 0 {
+		delete(l.locks, sessionID)
+	}
+}
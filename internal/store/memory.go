@@ -0,0 +1,269 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/customer"
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+	"carlospayan/agent-comercial-ai/internal/tradein"
+	"carlospayan/agent-comercial-ai/internal/usage"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Memory keeps the sessions in the process: they are lost on restart and
+// not shared between replicas. A reset session keeps only its last car and
+// the time of its last message, until forgetAt.
+type Memory struct {
+	*sessionLocks
+	maxHistory   int
+	mu           sync.Mutex
+	messageHist  map[string][]openai.ChatCompletionMessage
+	lastCarStore map[string]catalog.Car
+	promptStore  map[string]string
+	variantStore map[string]string
+	recsStore    map[string][]catalog.Car
+	langStore    map[string]i18n.Lang
+	termsStore   map[string]financing.Terms
+	tradeInStore map[string]tradein.TradeIn
+	usageStore   map[string]usage.Totals
+	started      map[string]time.Time
+	lastMessage  map[string]time.Time
+	forgetAt     map[string]time.Time
+	profiles     map[string]customer.Profile
+}
+
+// NewMemory keeps up to maxHistory messages of each conversation besides
+// its opening ones; 0 keeps them all.
+func NewMemory(maxHistory int) *Memory {
+	return &Memory{
+		sessionLocks: newSessionLocks(),
+		maxHistory:   maxHistory,
+		messageHist:  make(map[string][]openai.ChatCompletionMessage),
+		lastCarStore: make(map[string]catalog.Car),
+		promptStore:  make(map[string]string),
+		variantStore: make(map[string]string),
+		recsStore:    make(map[string][]catalog.Car),
+		langStore:    make(map[string]i18n.Lang),
+		termsStore:   make(map[string]financing.Terms),
+		tradeInStore: make(map[string]tradein.TradeIn),
+		usageStore:   make(map[string]usage.Totals),
+		started:      make(map[string]time.Time),
+		lastMessage:  make(map[string]time.Time),
+		forgetAt:     make(map[string]time.Time),
+		profiles:     make(map[string]customer.Profile),
+	}
+}
+
+func (m *Memory) GetHistory(sessionID string) []openai.ChatCompletionMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]openai.ChatCompletionMessage(nil), m.messageHist[sessionID]...)
+}
+
+func (m *Memory) AppendMessage(sessionID string, msg openai.ChatCompletionMessage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messageHist[sessionID] = trimHistory(append(m.messageHist[sessionID], msg), m.maxHistory)
+	now := time.Now()
+	if _, ok := m.started[sessionID]; !ok {
+		m.started[sessionID] = now
+	}
+	m.lastMessage[sessionID] = now
+	delete(m.forgetAt, sessionID)
+}
+
+func (m *Memory) SetLastCar(sessionID string, car catalog.Car) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastCarStore[sessionID] = car
+}
+
+func (m *Memory) GetLastCar(sessionID string) (catalog.Car, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	car, ok := m.lastCarStore[sessionID]
+	return car, ok
+}
+
+func (m *Memory) SetRecommendations(sessionID string, cars []catalog.Car) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recsStore[sessionID] = cars
+}
+
+func (m *Memory) GetRecommendations(sessionID string) []catalog.Car {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]catalog.Car(nil), m.recsStore[sessionID]...)
+}
+
+func (m *Memory) SetPromptVersion(sessionID, version string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.promptStore[sessionID] = version
+}
+
+func (m *Memory) GetPromptVersion(sessionID string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	version, ok := m.promptStore[sessionID]
+	return version, ok
+}
+
+func (m *Memory) SetVariant(sessionID, variant string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.variantStore[sessionID] = variant
+}
+
+func (m *Memory) GetVariant(sessionID string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	variant, ok := m.variantStore[sessionID]
+	return variant, ok
+}
+
+func (m *Memory) SetLanguage(sessionID string, lang i18n.Lang) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.langStore[sessionID] = lang
+}
+
+func (m *Memory) GetLanguage(sessionID string) (i18n.Lang, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lang, ok := m.langStore[sessionID]
+	return lang, ok
+}
+
+func (m *Memory) SetFinancingTerms(sessionID string, terms financing.Terms) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.termsStore[sessionID] = terms
+}
+
+func (m *Memory) GetFinancingTerms(sessionID string) financing.Terms {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.termsStore[sessionID]
+}
+
+func (m *Memory) SetTradeIn(sessionID string, t tradein.TradeIn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tradeInStore[sessionID] = t
+}
+
+func (m *Memory) GetTradeIn(sessionID string) tradein.TradeIn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tradeInStore[sessionID]
+}
+
+func (m *Memory) AddUsage(sessionID string, t usage.Totals) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usageStore[sessionID] = m.usageStore[sessionID].Add(t)
+}
+
+func (m *Memory) GetUsage(sessionID string) (usage.Totals, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.usageStore[sessionID]
+	return t, ok
+}
+
+func (m *Memory) Activity(sessionID string) (Activity, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	last, ok := m.lastMessage[sessionID]
+	return Activity{Started: m.started[sessionID], LastMessage: last}, ok
+}
+
+func (m *Memory) Expired(idleBefore, startedBefore time.Time) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	for id, started := range m.started {
+		if !idleBefore.IsZero() && m.lastMessage[id].Before(idleBefore) ||
+			!startedBefore.IsZero() && started.Before(startedBefore) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (m *Memory) ResetSession(sessionID string, keep time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if keep > 0 {
+		m.forgetAt[sessionID] = time.Now().Add(keep)
+	}
+	delete(m.messageHist, sessionID)
+	delete(m.promptStore, sessionID)
+	delete(m.variantStore, sessionID)
+	delete(m.recsStore, sessionID)
+	delete(m.langStore, sessionID)
+	delete(m.termsStore, sessionID)
+	delete(m.tradeInStore, sessionID)
+	delete(m.usageStore, sessionID)
+	delete(m.started, sessionID)
+}
+
+func (m *Memory) Forget(now time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, at := range m.forgetAt {
+		if !now.Before(at) {
+			m.remove(id)
+			n++
+		}
+	}
+	return n
+}
+
+func (m *Memory) DeleteHistory(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(sessionID)
+}
+
+// remove forgets everything about the session; m.mu must be held.
+func (m *Memory) remove(sessionID string) {
+	delete(m.messageHist, sessionID)
+	delete(m.lastCarStore, sessionID)
+	delete(m.promptStore, sessionID)
+	delete(m.variantStore, sessionID)
+	delete(m.recsStore, sessionID)
+	delete(m.langStore, sessionID)
+	delete(m.termsStore, sessionID)
+	delete(m.tradeInStore, sessionID)
+	delete(m.usageStore, sessionID)
+	delete(m.started, sessionID)
+	delete(m.lastMessage, sessionID)
+	delete(m.forgetAt, sessionID)
+}
+
+func (m *Memory) SetProfile(customerID string, p customer.Profile) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.profiles[customerID] = p
+}
+
+func (m *Memory) GetProfile(customerID string) (customer.Profile, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.profiles[customerID]
+	return p, ok
+}
+
+func (m *Memory) DeleteProfile(customerID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.profiles, customerID)
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	testSessionStore(t, func(t *testing.T, maxHistory int) SessionStore {
+		return NewMemory(maxHistory)
+	})
+}
+
+func TestMemoryRetention(t *testing.T) {
+	m := NewMemory(0)
+	testRetention(t, m, func(d time.Duration) { m.Forget(time.Now().Add(d)) })
+}
+
+func TestMemoryForgetsEverything(t *testing.T) {
+	m := NewMemory(0)
+	startConversation(m, "s1")
+	m.SetLastCar("s1", testCar)
+	m.ResetSession("s1", time.Minute)
+	if n := m.Forget(time.Now().Add(time.Hour)); n != 1 {
+		t.Fatalf("forgot %d sessions, want 1", n)
+	}
+	if len(m.messageHist)+len(m.lastCarStore)+len(m.lastMessage)+len(m.forgetAt) != 0 {
+		t.Errorf("forgotten session left entries behind")
+	}
+}
+
+func TestSessionLocksRelease(t *testing.T) {
+	l := newSessionLocks()
+	unlock, err := l.Lock(context.Background(), "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Lock(ctx, "s1"); err == nil {
+		t.Errorf("Lock with a canceled context succeeded while held")
+	}
+	unlock()
+	if len(l.locks) != 0 {
+		t.Errorf("%d lock entries left after every turn released", len(l.locks))
+	}
+}
+
+func TestMemoryReadsDontStore(t *testing.T) {
+	m := NewMemory(0)
+	if hist := m.GetHistory("unknown"); hist != nil {
+		t.Errorf("unknown session has history %+v", hist)
+	}
+	if len(m.messageHist) != 0 {
+		t.Errorf("reading an unknown session stored it")
+	}
+
+	startConversation(m, "s1")
+	hist := m.GetHistory("s1")
+	hist[0].Content = "changed"
+	_ = append(hist[:1], message("user", "not stored"))
+	if got := contents(m.GetHistory("s1")); got[0] != "system prompt" || got[1] != "kavak info" {
+		t.Errorf("changing a read history changed the stored one: %q", got)
+	}
+}
@@ -0,0 +1,534 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/customer"
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+	"carlospayan/agent-comercial-ai/internal/tradein"
+	"carlospayan/agent-comercial-ai/internal/usage"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultRedisPrefix  = "agent:"
+	defaultRedisTimeout = 2 * time.Second
+	defaultRedisLockTTL = 2 * time.Minute
+
+	// lockPoll is how often a turn waiting for a session lock tries again.
+	lockPoll = 50 * time.Millisecond
+)
+
+// unlockScript deletes a session lock only if it's still the caller's, so
+// that a turn that outlived the lock TTL doesn't release the next one's.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// appendScript appends a message to a history (KEYS[1]) and, when it then
+// has more than the ARGV[2] opening messages plus the ARGV[3] latest ones
+// (0 for no limit), drops the messages in between.
+var appendScript = redis.NewScript(`
+local n = redis.call("RPUSH", KEYS[1], ARGV[1])
+local head, keep = tonumber(ARGV[2]), tonumber(ARGV[3])
+if keep > 0 and n > head + keep then
+	local opening = redis.call("LRANGE", KEYS[1], 0, head - 1)
+	redis.call("LTRIM", KEYS[1], n - keep, -1)
+	for i = #opening, 1, -1 do
+		redis.call("LPUSH", KEYS[1], opening[i])
+	end
+end
+return n`)
+
+// Fields of a session's hash with the Unix times of its activity.
+const (
+	fieldStarted     = "started_at"
+	fieldLastMessage = "last_message_at"
+)
+
+// Fields of a session's hash with its usage totals, incremented in place so
+// that concurrent calls don't lose each other's tokens.
+const (
+	fieldUsagePromptTokens     = "usage_prompt_tokens"
+	fieldUsageCompletionTokens = "usage_completion_tokens"
+	fieldUsageAudioSeconds     = "usage_audio_seconds"
+	fieldUsageCostUSD          = "usage_cost_usd"
+	fieldUsageCostMXN          = "usage_cost_mxn"
+)
+
+// resetFields are the fields a reset deletes: all but the last car and the
+// time of the last message.
+var resetFields = []string{
+	fieldRecommendations, fieldPromptVersion, fieldVariant, fieldLanguage,
+	fieldFinancingTerms, fieldTradeIn, fieldStarted,
+	fieldUsagePromptTokens, fieldUsageCompletionTokens, fieldUsageAudioSeconds, fieldUsageCostUSD, fieldUsageCostMXN,
+}
+
+// Redis keeps the sessions in Redis so that every replica sees them and they
+// survive deploys. A session is two keys: its history, a list appended to
+// with RPUSH, and a hash with the rest of its state, one JSON value per
+// field, which expires once the session is reset. Both share the session's
+// hash tag so that they live in the same cluster slot and can be written
+// together in a MULTI. Two sorted sets index
+// the sessions with a conversation by the time it started and the time of
+// its last message, for expiry. Customer profiles are a JSON value each.
+type Redis struct {
+	client     redis.UniversalClient
+	prefix     string
+	timeout    time.Duration
+	lockTTL    time.Duration
+	maxHistory int
+}
+
+// NewRedis connects to the server in cfg and checks that it answers.
+// Conversations keep up to maxHistory messages besides their opening ones;
+// 0 keeps them all.
+func NewRedis(cfg config.RedisConfig, maxHistory int) (*Redis, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	r := NewRedisClient(client, cfg.Prefix, cfg.Timeout, cfg.LockTTL, maxHistory)
+	ctx, cancel := r.context()
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("store: connecting to redis at %s: %w", cfg.Addr, err)
+	}
+	return r, nil
+}
+
+// NewRedisClient stores the sessions through client, e.g. a cluster client
+// or one connected to an in-process server. Keys start with prefix, every
+// call gives up after timeout, a session lock expires after lockTTL if its
+// holder never releases it and conversations keep up to maxHistory messages
+// besides their opening ones.
+func NewRedisClient(client redis.UniversalClient, prefix string, timeout, lockTTL time.Duration, maxHistory int) *Redis {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	if timeout <= 0 {
+		timeout = defaultRedisTimeout
+	}
+	if lockTTL <= 0 {
+		lockTTL = defaultRedisLockTTL
+	}
+	return &Redis{client: client, prefix: prefix, timeout: timeout, lockTTL: lockTTL, maxHistory: maxHistory}
+}
+
+func (r *Redis) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), r.timeout)
+}
+
+func (r *Redis) historyKey(sessionID string) string {
+	return r.prefix + "session:{" + sessionID + "}:history"
+}
+
+func (r *Redis) stateKey(sessionID string) string {
+	return r.prefix + "session:{" + sessionID + "}"
+}
+
+func (r *Redis) lockKey(sessionID string) string {
+	return r.prefix + "session:{" + sessionID + "}:lock"
+}
+
+func (r *Redis) profileKey(customerID string) string {
+	return r.prefix + "customer:" + customerID
+}
+
+func (r *Redis) startedKey() string {
+	return r.prefix + "sessions:started"
+}
+
+func (r *Redis) lastMessageKey() string {
+	return r.prefix + "sessions:last_message"
+}
+
+func (r *Redis) GetHistory(sessionID string) []openai.ChatCompletionMessage {
+	ctx, cancel := r.context()
+	defer cancel()
+	raw, err := r.client.LRange(ctx, r.historyKey(sessionID), 0, -1).Result()
+	if err != nil {
+		log.Printf("store: session %s: reading history: %v", sessionID, err)
+		return []openai.ChatCompletionMessage{}
+	}
+	hist := make([]openai.ChatCompletionMessage, 0, len(raw))
+	for _, m := range raw {
+		var msg openai.ChatCompletionMessage
+		if err := json.Unmarshal([]byte(m), &msg); err != nil {
+			log.Printf("store: session %s: skipping invalid message: %v", sessionID, err)
+			continue
+		}
+		hist = append(hist, msg)
+	}
+	return hist
+}
+
+func (r *Redis) AppendMessage(sessionID string, msg openai.ChatCompletionMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("store: session %s: encoding message: %v", sessionID, err)
+		return
+	}
+	ctx, cancel := r.context()
+	defer cancel()
+	now := time.Now().Unix()
+	_, err = r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		appendScript.Eval(ctx, p, []string{r.historyKey(sessionID)}, data, historyHead, r.maxHistory)
+		p.HSetNX(ctx, r.stateKey(sessionID), fieldStarted, now)
+		p.HSet(ctx, r.stateKey(sessionID), fieldLastMessage, now)
+		p.Persist(ctx, r.stateKey(sessionID))
+		return nil
+	})
+	if err != nil {
+		log.Printf("store: session %s: appending message: %v", sessionID, err)
+		return
+	}
+	_, err = r.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZAddNX(ctx, r.startedKey(), redis.Z{Score: float64(now), Member: sessionID})
+		p.ZAdd(ctx, r.lastMessageKey(), redis.Z{Score: float64(now), Member: sessionID})
+		return nil
+	})
+	if err != nil {
+		log.Printf("store: session %s: indexing session: %v", sessionID, err)
+	}
+}
+
+func (r *Redis) SetLastCar(sessionID string, car catalog.Car) {
+	r.set(sessionID, fieldLastCar, withoutEmbedding(car))
+}
+
+func (r *Redis) GetLastCar(sessionID string) (catalog.Car, bool) {
+	var car catalog.Car
+	ok := r.get(sessionID, fieldLastCar, &car)
+	return car, ok
+}
+
+func (r *Redis) SetRecommendations(sessionID string, cars []catalog.Car) {
+	r.set(sessionID, fieldRecommendations, withoutEmbeddings(cars))
+}
+
+func (r *Redis) GetRecommendations(sessionID string) []catalog.Car {
+	var cars []catalog.Car
+	r.get(sessionID, fieldRecommendations, &cars)
+	return cars
+}
+
+func (r *Redis) SetPromptVersion(sessionID, version string) {
+	r.set(sessionID, fieldPromptVersion, version)
+}
+
+func (r *Redis) GetPromptVersion(sessionID string) (string, bool) {
+	var version string
+	ok := r.get(sessionID, fieldPromptVersion, &version)
+	return version, ok
+}
+
+func (r *Redis) SetVariant(sessionID, variant string) {
+	r.set(sessionID, fieldVariant, variant)
+}
+
+func (r *Redis) GetVariant(sessionID string) (string, bool) {
+	var variant string
+	ok := r.get(sessionID, fieldVariant, &variant)
+	return variant, ok
+}
+
+func (r *Redis) SetLanguage(sessionID string, lang i18n.Lang) {
+	r.set(sessionID, fieldLanguage, lang)
+}
+
+func (r *Redis) GetLanguage(sessionID string) (i18n.Lang, bool) {
+	var lang i18n.Lang
+	ok := r.get(sessionID, fieldLanguage, &lang)
+	return lang, ok
+}
+
+func (r *Redis) SetFinancingTerms(sessionID string, terms financing.Terms) {
+	r.set(sessionID, fieldFinancingTerms, terms)
+}
+
+func (r *Redis) GetFinancingTerms(sessionID string) financing.Terms {
+	var terms financing.Terms
+	r.get(sessionID, fieldFinancingTerms, &terms)
+	return terms
+}
+
+func (r *Redis) SetTradeIn(sessionID string, t tradein.TradeIn) {
+	r.set(sessionID, fieldTradeIn, t)
+}
+
+func (r *Redis) GetTradeIn(sessionID string) tradein.TradeIn {
+	var t tradein.TradeIn
+	r.get(sessionID, fieldTradeIn, &t)
+	return t
+}
+
+func (r *Redis) AddUsage(sessionID string, t usage.Totals) {
+	ctx, cancel := r.context()
+	defer cancel()
+	key := r.stateKey(sessionID)
+	_, err := r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HIncrBy(ctx, key, fieldUsagePromptTokens, int64(t.PromptTokens))
+		p.HIncrBy(ctx, key, fieldUsageCompletionTokens, int64(t.CompletionTokens))
+		p.HIncrByFloat(ctx, key, fieldUsageAudioSeconds, t.AudioSeconds)
+		p.HIncrByFloat(ctx, key, fieldUsageCostUSD, t.CostUSD)
+		p.HIncrByFloat(ctx, key, fieldUsageCostMXN, t.CostMXN)
+		return nil
+	})
+	if err != nil {
+		log.Printf("store: session %s: writing usage: %v", sessionID, err)
+	}
+}
+
+func (r *Redis) GetUsage(sessionID string) (usage.Totals, bool) {
+	ctx, cancel := r.context()
+	defer cancel()
+	vals, err := r.client.HMGet(ctx, r.stateKey(sessionID),
+		fieldUsagePromptTokens, fieldUsageCompletionTokens, fieldUsageAudioSeconds, fieldUsageCostUSD, fieldUsageCostMXN).Result()
+	if err != nil {
+		log.Printf("store: session %s: reading usage: %v", sessionID, err)
+		return usage.Totals{}, false
+	}
+	if vals[0] == nil {
+		return usage.Totals{}, false
+	}
+	var nums [5]float64
+	for i, v := range vals {
+		str, _ := v.(string)
+		nums[i], _ = strconv.ParseFloat(str, 64)
+	}
+	return usage.Totals{
+		PromptTokens:     int(nums[0]),
+		CompletionTokens: int(nums[1]),
+		AudioSeconds:     nums[2],
+		CostUSD:          nums[3],
+		CostMXN:          nums[4],
+	}, true
+}
+
+func (r *Redis) Activity(sessionID string) (Activity, bool) {
+	ctx, cancel := r.context()
+	defer cancel()
+	vals, err := r.client.HMGet(ctx, r.stateKey(sessionID), fieldStarted, fieldLastMessage).Result()
+	if err != nil {
+		log.Printf("store: session %s: reading activity: %v", sessionID, err)
+		return Activity{}, false
+	}
+	last, ok := unixField(vals[1])
+	if !ok {
+		return Activity{}, false
+	}
+	a := Activity{LastMessage: last}
+	a.Started, _ = unixField(vals[0])
+	return a, true
+}
+
+func (r *Redis) Expired(idleBefore, startedBefore time.Time) []string {
+	ctx, cancel := r.context()
+	defer cancel()
+	seen := make(map[string]bool)
+	var ids []string
+	for key, before := range map[string]time.Time{r.lastMessageKey(): idleBefore, r.startedKey(): startedBefore} {
+		if before.IsZero() {
+			continue
+		}
+		found, err := r.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+			Min: "-inf",
+			Max: "(" + strconv.FormatInt(before.Unix(), 10),
+		}).Result()
+		if err != nil {
+			log.Printf("store: listing expired sessions: %v", err)
+			continue
+		}
+		for _, id := range found {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// ResetSession expires what's left of the session's state after keep, so
+// that Redis forgets the users who don't come back.
+func (r *Redis) ResetSession(sessionID string, keep time.Duration) {
+	ctx, cancel := r.context()
+	defer cancel()
+	_, err := r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Del(ctx, r.historyKey(sessionID))
+		p.HDel(ctx, r.stateKey(sessionID), resetFields...)
+		if keep > 0 {
+			p.Expire(ctx, r.stateKey(sessionID), keep)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("store: session %s: resetting session: %v", sessionID, err)
+		return
+	}
+	r.unindex(ctx, sessionID)
+}
+
+// Forget has nothing to do: reset sessions expire.
+func (r *Redis) Forget(now time.Time) int {
+	return 0
+}
+
+// DeleteHistory removes both keys of the session in one DEL, which Redis
+// runs atomically.
+func (r *Redis) DeleteHistory(sessionID string) {
+	ctx, cancel := r.context()
+	defer cancel()
+	if err := r.client.Del(ctx, r.historyKey(sessionID), r.stateKey(sessionID)).Err(); err != nil {
+		log.Printf("store: session %s: deleting session: %v", sessionID, err)
+		return
+	}
+	r.unindex(ctx, sessionID)
+}
+
+func (r *Redis) SetProfile(customerID string, p customer.Profile) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("store: customer %s: encoding profile: %v", customerID, err)
+		return
+	}
+	ctx, cancel := r.context()
+	defer cancel()
+	if err := r.client.Set(ctx, r.profileKey(customerID), data, 0).Err(); err != nil {
+		log.Printf("store: customer %s: writing profile: %v", customerID, err)
+	}
+}
+
+func (r *Redis) GetProfile(customerID string) (customer.Profile, bool) {
+	ctx, cancel := r.context()
+	defer cancel()
+	data, err := r.client.Get(ctx, r.profileKey(customerID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return customer.Profile{}, false
+	}
+	if err != nil {
+		log.Printf("store: customer %s: reading profile: %v", customerID, err)
+		return customer.Profile{}, false
+	}
+	var p customer.Profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		log.Printf("store: customer %s: decoding profile: %v", customerID, err)
+		return customer.Profile{}, false
+	}
+	return p, true
+}
+
+func (r *Redis) DeleteProfile(customerID string) {
+	ctx, cancel := r.context()
+	defer cancel()
+	if err := r.client.Del(ctx, r.profileKey(customerID)).Err(); err != nil {
+		log.Printf("store: customer %s: deleting profile: %v", customerID, err)
+	}
+}
+
+// Lock takes the session's lock key with SET NX, trying again until it's
+// free or ctx is done, so that turns of a session are serialized across
+// replicas.
+func (r *Redis) Lock(ctx context.Context, sessionID string) (func(), error) {
+	token := uuid.New().String()
+	key := r.lockKey(sessionID)
+	for {
+		ok, err := r.client.SetNX(ctx, key, token, r.lockTTL).Result()
+		if err != nil {
+			return nil, fmt.Errorf("store: locking session %s: %w", sessionID, err)
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ctx, cancel := r.context()
+			defer cancel()
+			if err := unlockScript.Run(ctx, r.client, []string{key}, token).Err(); err != nil {
+				log.Printf("store: session %s: unlocking session: %v", sessionID, err)
+			}
+		})
+	}, nil
+}
+
+// unindex removes the session from the expiry indexes.
+func (r *Redis) unindex(ctx context.Context, sessionID string) {
+	_, err := r.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZRem(ctx, r.startedKey(), sessionID)
+		p.ZRem(ctx, r.lastMessageKey(), sessionID)
+		return nil
+	})
+	if err != nil {
+		log.Printf("store: session %s: unindexing session: %v", sessionID, err)
+	}
+}
+
+func (r *Redis) set(sessionID, field string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("store: session %s: encoding %s: %v", sessionID, field, err)
+		return
+	}
+	ctx, cancel := r.context()
+	defer cancel()
+	if err := r.client.HSet(ctx, r.stateKey(sessionID), field, data).Err(); err != nil {
+		log.Printf("store: session %s: writing %s: %v", sessionID, field, err)
+	}
+}
+
+// get decodes field into v and reports whether the session has it.
+func (r *Redis) get(sessionID, field string, v any) bool {
+	ctx, cancel := r.context()
+	defer cancel()
+	data, err := r.client.HGet(ctx, r.stateKey(sessionID), field).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false
+	}
+	if err != nil {
+		log.Printf("store: session %s: reading %s: %v", sessionID, field, err)
+		return false
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		log.Printf("store: session %s: decoding %s: %v", sessionID, field, err)
+		return false
+	}
+	return true
+}
+
+// unixField reads a time stored as Unix seconds in a hash field.
+func unixField(v any) (time.Time, bool) {
+	str, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0), true
+}
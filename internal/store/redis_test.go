@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedis returns a store backed by an in-process Redis that is shut
+// down when the test ends.
+func newTestRedis(t *testing.T, maxHistory int) (*Redis, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisClient(client, "test:", time.Second, time.Second, maxHistory), server
+}
+
+func TestRedis(t *testing.T) {
+	testSessionStore(t, func(t *testing.T, maxHistory int) SessionStore {
+		r, _ := newTestRedis(t, maxHistory)
+		return r
+	})
+}
+
+func TestRedisRetention(t *testing.T) {
+	r, server := newTestRedis(t, 0)
+	testRetention(t, r, server.FastForward)
+}
+
+func TestRedisKeys(t *testing.T) {
+	r, server := newTestRedis(t, 0)
+	startConversation(r, "s1")
+	car := testCar
+	car.Embedding = []float32{0.1, 0.2}
+	r.SetLastCar("s1", car)
+
+	// The history and the state share the session's hash tag, so that a
+	// MULTI can write both in a cluster.
+	keys := server.Keys()
+	for _, want := range []string{"test:session:{s1}", "test:session:{s1}:history", "test:sessions:started", "test:sessions:last_message"} {
+		if !slices.Contains(keys, want) {
+			t.Errorf("keys %v, missing %s", keys, want)
+		}
+	}
+	if stored := server.HGet("test:session:{s1}", fieldLastCar); !strings.Contains(stored, `"Embedding":null`) {
+		t.Errorf("last car stored with its embedding: %s", stored)
+	}
+
+	r.DeleteHistory("s1")
+	for _, key := range []string{"test:session:{s1}", "test:session:{s1}:history"} {
+		if server.Exists(key) {
+			t.Errorf("%s still exists after delete", key)
+		}
+	}
+	if members, _ := server.ZMembers("test:sessions:last_message"); slices.Contains(members, "s1") {
+		t.Errorf("deleted session still indexed")
+	}
+}
+
+func TestRedisTrimKeepsOpening(t *testing.T) {
+	r, server := newTestRedis(t, 2)
+	startConversation(r, "s1")
+	for _, m := range []string{"a", "b", "c", "d"} {
+		r.AppendMessage("s1", message("user", m))
+	}
+	list, err := server.List("test:session:{s1}:history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != historyHead+2 {
+		t.Errorf("history list has %d entries, want %d", len(list), historyHead+2)
+	}
+	want := []string{"system prompt", "kavak info", "c", "d"}
+	if got := contents(r.GetHistory("s1")); !slices.Equal(got, want) {
+		t.Errorf("history %q, want %q", got, want)
+	}
+}
+
+// TestRedisLockExpires checks that the lock of a replica that died while
+// holding it is freed by its TTL, and that the dead holder's unlock, if it
+// ever runs, doesn't release the next holder's lock.
+func TestRedisLockExpires(t *testing.T) {
+	r, server := newTestRedis(t, 0)
+	stale, err := r.Lock(context.Background(), "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	if _, err := r.Lock(ctx, "s1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock of a held session = %v, want the deadline error", err)
+	}
+
+	server.FastForward(2 * time.Second)
+	unlock, err := r.Lock(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("Lock after the TTL: %v", err)
+	}
+	defer unlock()
+
+	stale()
+	if !server.Exists("test:session:{s1}:lock") {
+		t.Errorf("the expired holder released the new holder's lock")
+	}
+}
@@ -0,0 +1,535 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/customer"
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+	"carlospayan/agent-comercial-ai/internal/tradein"
+	"carlospayan/agent-comercial-ai/internal/usage"
+
+	"github.com/sashabaranov/go-openai"
+	_ "modernc.org/sqlite"
+)
+
+const defaultSQLitePath = "data/sessions.db"
+
+// migrations create and evolve the schema. Each one runs once, in order, in
+// its own transaction; its version is its position in the list plus one.
+// Never edit a migration that has shipped: append a new one.
+var migrations = []string{
+	// 1: sessions, their messages and their state, one JSON value per field.
+	`CREATE TABLE sessions (
+		id         TEXT PRIMARY KEY,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE TABLE messages (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		role       TEXT NOT NULL,
+		data       TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX messages_session ON messages(session_id, id);
+	CREATE TABLE session_state (
+		session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		field      TEXT NOT NULL,
+		value      TEXT NOT NULL,
+		PRIMARY KEY (session_id, field)
+	);`,
+	// 2: compaction looks sessions up by their last write.
+	`CREATE INDEX sessions_updated ON sessions(updated_at);`,
+	// 3: expiry; started_at is 0 while the session has no conversation.
+	`ALTER TABLE sessions ADD COLUMN started_at INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE sessions ADD COLUMN last_message_at INTEGER NOT NULL DEFAULT 0;
+	UPDATE sessions SET started_at = created_at, last_message_at = updated_at
+		WHERE EXISTS (SELECT 1 FROM messages WHERE session_id = sessions.id);
+	CREATE INDEX sessions_last_message ON sessions(last_message_at);
+	CREATE INDEX sessions_started ON sessions(started_at);`,
+	// 4: customer profiles, which compaction leaves alone.
+	`CREATE TABLE customers (
+		id         TEXT PRIMARY KEY,
+		data       TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	);`,
+	// 5: when a reset session is forgotten; 0 while it has a conversation
+	// or is kept until deleted.
+	`ALTER TABLE sessions ADD COLUMN forget_at INTEGER NOT NULL DEFAULT 0;
+	CREATE INDEX sessions_forget ON sessions(forget_at);`,
+}
+
+// SQLite keeps the sessions in a SQLite file so that they survive restarts
+// without running a server, e.g. on a single node. Session locks are held in
+// the process, which is the only one using the file. Every write runs in a
+// transaction that also marks when the session was last written, which is
+// what compaction uses to expire idle sessions.
+type SQLite struct {
+	*sessionLocks
+	db         *sql.DB
+	retention  time.Duration
+	maxHistory int
+	stop       chan struct{}
+}
+
+// NewSQLite opens (or creates) the database at cfg.Path, brings its schema
+// up to date and, when cfg.CompactInterval is set, starts compacting it on
+// that interval. Conversations keep up to maxHistory messages besides their
+// opening ones; 0 keeps them all.
+func NewSQLite(cfg config.SQLiteConfig, maxHistory int) (*SQLite, error) {
+	path := cfg.Path
+	if path == "" {
+		path = defaultSQLitePath
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("store: creating %s: %w", dir, err)
+		}
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, fmt.Errorf("store: opening %s: %w", path, err)
+	}
+	// A single connection serializes the writes, which SQLite would do
+	// anyway, without busy errors.
+	db.SetMaxOpenConns(1)
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("store: migrating %s: %w", path, err)
+	}
+
+	s := &SQLite{sessionLocks: newSessionLocks(), db: db, retention: cfg.Retention, maxHistory: maxHistory, stop: make(chan struct{})}
+	if cfg.CompactInterval > 0 {
+		go s.compactEvery(cfg.CompactInterval)
+	}
+	return s, nil
+}
+
+// migrate runs the migrations the database hasn't run yet.
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return err
+	}
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this build (%d)", current, len(migrations))
+	}
+	for i := current; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, i+1, time.Now().Unix()); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("store: applied session schema migration %d", i+1)
+	}
+	return nil
+}
+
+// Close stops the compaction job and closes the database.
+func (s *SQLite) Close() error {
+	close(s.stop)
+	return s.db.Close()
+}
+
+func (s *SQLite) compactEvery(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			if err := s.Compact(context.Background()); err != nil {
+				log.Printf("store: compaction failed: %v", err)
+			}
+		}
+	}
+}
+
+// Compact deletes the sessions nobody has written to for longer than the
+// retention (none when it's 0) and gives the space they used back to the
+// file system.
+func (s *SQLite) Compact(ctx context.Context) error {
+	start := time.Now()
+	var expired int64
+	if s.retention > 0 {
+		res, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE updated_at < ?`, start.Add(-s.retention).Unix())
+		if err != nil {
+			return fmt.Errorf("deleting expired sessions: %w", err)
+		}
+		expired, _ = res.RowsAffected()
+	}
+	if _, err := s.db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return fmt.Errorf("checkpointing: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `VACUUM`); err != nil {
+		return fmt.Errorf("vacuuming: %w", err)
+	}
+	log.Printf("store: compacted sessions in %s, %d expired", time.Since(start).Round(time.Millisecond), expired)
+	return nil
+}
+
+// write runs fn in a transaction after creating the session or marking it as
+// written now.
+func (s *SQLite) write(sessionID, what string, fn func(tx *sql.Tx) error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("store: session %s: writing %s: %v", sessionID, what, err)
+		return
+	}
+	now := time.Now().Unix()
+	_, err = tx.Exec(`INSERT INTO sessions (id, created_at, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET updated_at = excluded.updated_at`, sessionID, now, now)
+	if err == nil {
+		err = fn(tx)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Printf("store: session %s: writing %s: %v", sessionID, what, err)
+	}
+}
+
+func (s *SQLite) GetHistory(sessionID string) []openai.ChatCompletionMessage {
+	hist := []openai.ChatCompletionMessage{}
+	rows, err := s.db.Query(`SELECT data FROM messages WHERE session_id = ? ORDER BY id`, sessionID)
+	if err != nil {
+		log.Printf("store: session %s: reading history: %v", sessionID, err)
+		return hist
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		var msg openai.ChatCompletionMessage
+		if err := rows.Scan(&data); err != nil {
+			log.Printf("store: session %s: reading history: %v", sessionID, err)
+			return hist
+		}
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			log.Printf("store: session %s: skipping invalid message: %v", sessionID, err)
+			continue
+		}
+		hist = append(hist, msg)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("store: session %s: reading history: %v", sessionID, err)
+	}
+	return hist
+}
+
+func (s *SQLite) AppendMessage(sessionID string, msg openai.ChatCompletionMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("store: session %s: encoding message: %v", sessionID, err)
+		return
+	}
+	s.write(sessionID, "message", func(tx *sql.Tx) error {
+		now := time.Now().Unix()
+		if _, err := tx.Exec(`INSERT INTO messages (session_id, role, data, created_at) VALUES (?, ?, ?, ?)`,
+			sessionID, msg.Role, string(data), now); err != nil {
+			return err
+		}
+		if s.maxHistory > 0 {
+			if _, err := tx.Exec(`DELETE FROM messages WHERE session_id = ?
+				AND id IN (SELECT id FROM messages WHERE session_id = ? ORDER BY id LIMIT -1 OFFSET ?)
+				AND id NOT IN (SELECT id FROM messages WHERE session_id = ? ORDER BY id DESC LIMIT ?)`,
+				sessionID, sessionID, historyHead, sessionID, s.maxHistory); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`UPDATE sessions SET last_message_at = ?, forget_at = 0,
+			started_at = CASE WHEN started_at = 0 THEN ? ELSE started_at END WHERE id = ?`, now, now, sessionID)
+		return err
+	})
+}
+
+func (s *SQLite) SetLastCar(sessionID string, car catalog.Car) {
+	s.set(sessionID, fieldLastCar, withoutEmbedding(car))
+}
+
+func (s *SQLite) GetLastCar(sessionID string) (catalog.Car, bool) {
+	var car catalog.Car
+	ok := s.get(sessionID, fieldLastCar, &car)
+	return car, ok
+}
+
+func (s *SQLite) SetRecommendations(sessionID string, cars []catalog.Car) {
+	s.set(sessionID, fieldRecommendations, withoutEmbeddings(cars))
+}
+
+func (s *SQLite) GetRecommendations(sessionID string) []catalog.Car {
+	var cars []catalog.Car
+	s.get(sessionID, fieldRecommendations, &cars)
+	return cars
+}
+
+func (s *SQLite) SetPromptVersion(sessionID, version string) {
+	s.set(sessionID, fieldPromptVersion, version)
+}
+
+func (s *SQLite) GetPromptVersion(sessionID string) (string, bool) {
+	var version string
+	ok := s.get(sessionID, fieldPromptVersion, &version)
+	return version, ok
+}
+
+func (s *SQLite) SetVariant(sessionID, variant string) {
+	s.set(sessionID, fieldVariant, variant)
+}
+
+func (s *SQLite) GetVariant(sessionID string) (string, bool) {
+	var variant string
+	ok := s.get(sessionID, fieldVariant, &variant)
+	return variant, ok
+}
+
+func (s *SQLite) SetLanguage(sessionID string, lang i18n.Lang) {
+	s.set(sessionID, fieldLanguage, lang)
+}
+
+func (s *SQLite) GetLanguage(sessionID string) (i18n.Lang, bool) {
+	var lang i18n.Lang
+	ok := s.get(sessionID, fieldLanguage, &lang)
+	return lang, ok
+}
+
+func (s *SQLite) SetFinancingTerms(sessionID string, terms financing.Terms) {
+	s.set(sessionID, fieldFinancingTerms, terms)
+}
+
+func (s *SQLite) GetFinancingTerms(sessionID string) financing.Terms {
+	var terms financing.Terms
+	s.get(sessionID, fieldFinancingTerms, &terms)
+	return terms
+}
+
+func (s *SQLite) SetTradeIn(sessionID string, t tradein.TradeIn) {
+	s.set(sessionID, fieldTradeIn, t)
+}
+
+func (s *SQLite) GetTradeIn(sessionID string) tradein.TradeIn {
+	var t tradein.TradeIn
+	s.get(sessionID, fieldTradeIn, &t)
+	return t
+}
+
+// AddUsage adds to the stored totals in the same transaction that reads
+// them, so that concurrent calls don't lose each other's tokens.
+func (s *SQLite) AddUsage(sessionID string, t usage.Totals) {
+	s.write(sessionID, fieldUsage, func(tx *sql.Tx) error {
+		var data string
+		var total usage.Totals
+		err := tx.QueryRow(`SELECT value FROM session_state WHERE session_id = ? AND field = ?`, sessionID, fieldUsage).Scan(&data)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal([]byte(data), &total); err != nil {
+				return err
+			}
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+		updated, err := json.Marshal(total.Add(t))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO session_state (session_id, field, value) VALUES (?, ?, ?)
+			ON CONFLICT (session_id, field) DO UPDATE SET value = excluded.value`, sessionID, fieldUsage, string(updated))
+		return err
+	})
+}
+
+func (s *SQLite) GetUsage(sessionID string) (usage.Totals, bool) {
+	var t usage.Totals
+	ok := s.get(sessionID, fieldUsage, &t)
+	return t, ok
+}
+
+func (s *SQLite) Activity(sessionID string) (Activity, bool) {
+	var started, last int64
+	err := s.db.QueryRow(`SELECT started_at, last_message_at FROM sessions WHERE id = ? AND last_message_at > 0`, sessionID).Scan(&started, &last)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Activity{}, false
+	}
+	if err != nil {
+		log.Printf("store: session %s: reading activity: %v", sessionID, err)
+		return Activity{}, false
+	}
+	a := Activity{LastMessage: time.Unix(last, 0)}
+	if started > 0 {
+		a.Started = time.Unix(started, 0)
+	}
+	return a, true
+}
+
+func (s *SQLite) Expired(idleBefore, startedBefore time.Time) []string {
+	rows, err := s.db.Query(`SELECT id FROM sessions WHERE started_at > 0 AND (last_message_at < ? OR started_at < ?)`,
+		unixOrZero(idleBefore), unixOrZero(startedBefore))
+	if err != nil {
+		log.Printf("store: listing expired sessions: %v", err)
+		return nil
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			log.Printf("store: listing expired sessions: %v", err)
+			return ids
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// ResetSession deletes the session's messages and state but its last car in
+// one transaction.
+func (s *SQLite) ResetSession(sessionID string, keep time.Duration) {
+	var forgetAt int64
+	if keep > 0 {
+		forgetAt = time.Now().Add(keep).Unix()
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("store: session %s: resetting session: %v", sessionID, err)
+		return
+	}
+	_, err = tx.Exec(`DELETE FROM messages WHERE session_id = ?`, sessionID)
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM session_state WHERE session_id = ? AND field <> ?`, sessionID, fieldLastCar)
+	}
+	if err == nil {
+		_, err = tx.Exec(`UPDATE sessions SET started_at = 0, forget_at = ? WHERE id = ?`, forgetAt, sessionID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Printf("store: session %s: resetting session: %v", sessionID, err)
+	}
+}
+
+func (s *SQLite) Forget(now time.Time) int {
+	res, err := s.db.Exec(`DELETE FROM sessions WHERE forget_at > 0 AND forget_at <= ?`, now.Unix())
+	if err != nil {
+		log.Printf("store: forgetting reset sessions: %v", err)
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	return int(n)
+}
+
+// DeleteHistory deletes the session; its messages and state go with it.
+func (s *SQLite) DeleteHistory(sessionID string) {
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE id = ?`, sessionID); err != nil {
+		log.Printf("store: session %s: deleting session: %v", sessionID, err)
+	}
+}
+
+func (s *SQLite) SetProfile(customerID string, p customer.Profile) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("store: customer %s: encoding profile: %v", customerID, err)
+		return
+	}
+	if _, err := s.db.Exec(`INSERT INTO customers (id, data, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		customerID, string(data), time.Now().Unix()); err != nil {
+		log.Printf("store: customer %s: writing profile: %v", customerID, err)
+	}
+}
+
+func (s *SQLite) GetProfile(customerID string) (customer.Profile, bool) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM customers WHERE id = ?`, customerID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return customer.Profile{}, false
+	}
+	if err != nil {
+		log.Printf("store: customer %s: reading profile: %v", customerID, err)
+		return customer.Profile{}, false
+	}
+	var p customer.Profile
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		log.Printf("store: customer %s: decoding profile: %v", customerID, err)
+		return customer.Profile{}, false
+	}
+	return p, true
+}
+
+func (s *SQLite) DeleteProfile(customerID string) {
+	if _, err := s.db.Exec(`DELETE FROM customers WHERE id = ?`, customerID); err != nil {
+		log.Printf("store: customer %s: deleting profile: %v", customerID, err)
+	}
+}
+
+func (s *SQLite) set(sessionID, field string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("store: session %s: encoding %s: %v", sessionID, field, err)
+		return
+	}
+	s.write(sessionID, field, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO session_state (session_id, field, value) VALUES (?, ?, ?)
+			ON CONFLICT (session_id, field) DO UPDATE SET value = excluded.value`, sessionID, field, string(data))
+		return err
+	})
+}
+
+// get decodes field into v and reports whether the session has it.
+func (s *SQLite) get(sessionID, field string, v any) bool {
+	var data string
+	err := s.db.QueryRow(`SELECT value FROM session_state WHERE session_id = ? AND field = ?`, sessionID, field).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		log.Printf("store: session %s: reading %s: %v", sessionID, field, err)
+		return false
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		log.Printf("store: session %s: decoding %s: %v", sessionID, field, err)
+		return false
+	}
+	return true
+}
+
+// unixOrZero is t in Unix seconds, or 0 (a time nothing is before) when t is
+// zero.
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/customer"
+)
+
+func newTestSQLite(t *testing.T, cfg config.SQLiteConfig, maxHistory int) *SQLite {
+	t.Helper()
+	if cfg.Path == "" {
+		cfg.Path = filepath.Join(t.TempDir(), "sessions.db")
+	}
+	s, err := NewSQLite(cfg, maxHistory)
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLite(t *testing.T) {
+	testSessionStore(t, func(t *testing.T, maxHistory int) SessionStore {
+		return newTestSQLite(t, config.SQLiteConfig{}, maxHistory)
+	})
+}
+
+func TestSQLiteRetention(t *testing.T) {
+	s := newTestSQLite(t, config.SQLiteConfig{}, 0)
+	testRetention(t, s, func(d time.Duration) { s.Forget(time.Now().Add(d)) })
+}
+
+func schemaVersions(t *testing.T, s *SQLite) (count, latest int) {
+	t.Helper()
+	if err := s.db.QueryRow(`SELECT COUNT(*), COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&count, &latest); err != nil {
+		t.Fatalf("reading schema_migrations: %v", err)
+	}
+	return count, latest
+}
+
+func TestSQLiteMigrationsRunOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "sessions.db")
+	first, err := NewSQLite(config.SQLiteConfig{Path: path}, 0)
+	if err != nil {
+		t.Fatalf("first open: %v", err)
+	}
+	startConversation(first, "s1")
+	first.SetLastCar("s1", testCar)
+	if count, latest := schemaVersions(t, first); count != len(migrations) || latest != len(migrations) {
+		t.Errorf("%d migrations recorded up to %d, want %d", count, latest, len(migrations))
+	}
+	if err := migrate(first.db); err != nil {
+		t.Errorf("migrating an up to date database: %v", err)
+	}
+	first.Close()
+
+	second := newTestSQLite(t, config.SQLiteConfig{Path: path}, 0)
+	if count, _ := schemaVersions(t, second); count != len(migrations) {
+		t.Errorf("%d migrations recorded after reopening, want %d", count, len(migrations))
+	}
+	if hist := second.GetHistory("s1"); len(hist) != 2 {
+		t.Errorf("history after reopening has %d messages, want 2", len(hist))
+	}
+	if car, ok := second.GetLastCar("s1"); !ok || car.StockID != testCar.StockID {
+		t.Errorf("last car after reopening: %+v, %v", car, ok)
+	}
+}
+
+func TestSQLiteRejectsNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	s := newTestSQLite(t, config.SQLiteConfig{Path: path}, 0)
+	if _, err := s.db.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, 0)`, len(migrations)+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(s.db); err == nil {
+		t.Errorf("migrate accepted a schema newer than the build")
+	}
+}
+
+func TestSQLiteCompact(t *testing.T) {
+	s := newTestSQLite(t, config.SQLiteConfig{Retention: time.Hour}, 0)
+	startConversation(s, "old")
+	startConversation(s, "recent")
+	s.SetProfile("old", customer.Profile{City: "Puebla"})
+	stale := time.Now().Add(-2 * time.Hour).Unix()
+	if _, err := s.db.Exec(`UPDATE sessions SET updated_at = ? WHERE id = ?`, stale, "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Compact(context.Background()); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if hist := s.GetHistory("old"); len(hist) != 0 {
+		t.Errorf("expired session still has %d messages", len(hist))
+	}
+	if _, ok := s.Activity("old"); ok {
+		t.Errorf("expired session still stored")
+	}
+	if hist := s.GetHistory("recent"); len(hist) != 2 {
+		t.Errorf("recent session has %d messages after compaction, want 2", len(hist))
+	}
+	if _, ok := s.GetProfile("old"); !ok {
+		t.Errorf("compaction deleted a customer profile")
+	}
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/customer"
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+	"carlospayan/agent-comercial-ai/internal/tradein"
+	"carlospayan/agent-comercial-ai/internal/usage"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+	BackendSQLite = "sqlite"
+)
+
+// Fields of a session's state in the backends that store it by name.
+const (
+	fieldLastCar         = "last_car"
+	fieldRecommendations = "recommendations"
+	fieldPromptVersion   = "prompt_version"
+	fieldVariant         = "variant"
+	fieldLanguage        = "language"
+	fieldFinancingTerms  = "financing_terms"
+	fieldTradeIn         = "trade_in"
+	fieldUsage           = "usage"
+)
+
+// historyHead is how many messages open a conversation, its system prompt
+// and the Kavak info; trimming the history never drops them.
+const historyHead = 2
+
+// SessionStore keeps the state of every conversation: its history and what
+// the engine knows about the session. Each call is atomic for its session;
+// Lock serializes whole turns.
+// Backends that can fail log the error and behave as if the value wasn't
+// stored, so that a turn is answered even without its history.
+type SessionStore interface {
+	// GetHistory returns a copy of the session's history, which callers may
+	// change; it's empty when the session has none.
+	GetHistory(sessionID string) []openai.ChatCompletionMessage
+	AppendMessage(sessionID string, msg openai.ChatCompletionMessage)
+
+	SetLastCar(sessionID string, car catalog.Car)
+	GetLastCar(sessionID string) (catalog.Car, bool)
+
+	SetRecommendations(sessionID string, cars []catalog.Car)
+	GetRecommendations(sessionID string) []catalog.Car
+
+	SetPromptVersion(sessionID, version string)
+	GetPromptVersion(sessionID string) (string, bool)
+
+	SetVariant(sessionID, variant string)
+	GetVariant(sessionID string) (string, bool)
+
+	SetLanguage(sessionID string, lang i18n.Lang)
+	GetLanguage(sessionID string) (i18n.Lang, bool)
+
+	SetFinancingTerms(sessionID string, terms financing.Terms)
+	GetFinancingTerms(sessionID string) financing.Terms
+
+	SetTradeIn(sessionID string, t tradein.TradeIn)
+	GetTradeIn(sessionID string) tradein.TradeIn
+
+	// AddUsage adds to the session's OpenAI usage totals, which are those of
+	// its current conversation: a reset or delete drops them.
+	AddUsage(sessionID string, t usage.Totals)
+	GetUsage(sessionID string) (usage.Totals, bool)
+
+	// Activity returns when the session's conversation started and when its
+	// last message was stored; false for a session never seen or deleted.
+	Activity(sessionID string) (Activity, bool)
+	// Expired returns the sessions with a conversation whose last message is
+	// older than idleBefore or which started before startedBefore. A zero
+	// time skips that check.
+	Expired(idleBefore, startedBefore time.Time) []string
+	// ResetSession forgets the session's conversation and state except its
+	// last car and when its last message was stored, so that a returning
+	// user can be welcomed back. Those are kept for keep, or until the
+	// session is deleted when keep is 0; a new conversation keeps them.
+	ResetSession(sessionID string, keep time.Duration)
+	// Forget deletes the reset sessions kept longer than their keep at now
+	// and returns how many; Redis expires them on its own.
+	Forget(now time.Time) int
+
+	// DeleteHistory forgets the session.
+	DeleteHistory(sessionID string)
+
+	// The profile of a customer outlives their sessions: it is kept until
+	// the customer deletes it.
+	SetProfile(customerID string, p customer.Profile)
+	GetProfile(customerID string) (customer.Profile, bool)
+	DeleteProfile(customerID string)
+
+	// Lock waits until no other turn of the session is running, or until
+	// ctx is done, and returns the function that lets the next one run.
+	// Turns must hold it, so that overlapping messages don't interleave
+	// their reads and writes.
+	Lock(ctx context.Context, sessionID string) (unlock func(), err error)
+}
+
+// Activity is when a session's conversation started, zero after a reset,
+// and when its last message was stored.
+type Activity struct {
+	Started     time.Time
+	LastMessage time.Time
+}
+
+// New returns the configured session store.
+func New(cfg config.StoreConfig) (SessionStore, error) {
+	switch cfg.Backend {
+	case BackendMemory, "":
+		return NewMemory(cfg.MaxHistory), nil
+	case BackendRedis:
+		return NewRedis(cfg.Redis, cfg.MaxHistory)
+	case BackendSQLite:
+		return NewSQLite(cfg.SQLite, cfg.MaxHistory)
+	default:
+		return nil, fmt.Errorf("store: unknown backend %q", cfg.Backend)
+	}
+}
+
+// withoutEmbedding drops the embedding of a car that is stored outside the
+// process: nothing reads it from the session and it would make up most of
+// its size.
+func withoutEmbedding(car catalog.Car) catalog.Car {
+	car.Embedding = nil
+	return car
+}
+
+// trimHistory keeps the opening messages of hist and its latest keep ones;
+// keep 0 keeps them all.
+func trimHistory(hist []openai.ChatCompletionMessage, keep int) []openai.ChatCompletionMessage {
+	if keep <= 0 || len(hist) <= historyHead+keep {
+		return hist
+	}
+	trimmed := make([]openai.ChatCompletionMessage, 0, historyHead+keep)
+	trimmed = append(trimmed, hist[:historyHead]...)
+	return append(trimmed, hist[len(hist)-keep:]...)
+}
+
+func withoutEmbeddings(cars []catalog.Car) []catalog.Car {
+	stored := make([]catalog.Car, len(cars))
+	for i, car := range cars {
+		stored[i] = withoutEmbedding(car)
+	}
+	return stored
+}
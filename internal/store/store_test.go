@@ -0,0 +1,407 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/customer"
+	"carlospayan/agent-comercial-ai/internal/financing"
+	"carlospayan/agent-comercial-ai/internal/i18n"
+	"carlospayan/agent-comercial-ai/internal/tradein"
+	"carlospayan/agent-comercial-ai/internal/usage"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// opener returns an empty store of the backend under test that keeps up to
+// maxHistory messages of a conversation besides its opening ones.
+type opener func(t *testing.T, maxHistory int) SessionStore
+
+// testSessionStore runs the behavior every backend shares.
+func testSessionStore(t *testing.T, open opener) {
+	t.Run("history", func(t *testing.T) { testHistory(t, open(t, 0)) })
+	t.Run("trim", func(t *testing.T) { testTrim(t, open(t, 3)) })
+	t.Run("last car", func(t *testing.T) { testLastCar(t, open(t, 0)) })
+	t.Run("state", func(t *testing.T) { testState(t, open(t, 0)) })
+	t.Run("profile", func(t *testing.T) { testProfile(t, open(t, 0)) })
+	t.Run("activity", func(t *testing.T) { testActivity(t, open(t, 0)) })
+	t.Run("reset", func(t *testing.T) { testReset(t, open(t, 0)) })
+	t.Run("delete", func(t *testing.T) { testDelete(t, open(t, 0)) })
+	t.Run("concurrent appends", func(t *testing.T) { testConcurrentAppends(t, open(t, 0)) })
+	t.Run("lock", func(t *testing.T) { testLock(t, open(t, 0)) })
+}
+
+var testCar = catalog.Car{StockID: "243587", Make: "Mazda", Model: "CX-5", Version: "Grand Touring", Year: 2019, Price: 396999, KM: 42000}
+
+func message(role, content string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{Role: role, Content: content}
+}
+
+func contents(hist []openai.ChatCompletionMessage) []string {
+	out := make([]string, len(hist))
+	for i, m := range hist {
+		out[i] = m.Content
+	}
+	return out
+}
+
+// startConversation stores the messages that open a conversation.
+func startConversation(s SessionStore, sid string) {
+	s.AppendMessage(sid, message("system", "system prompt"))
+	s.AppendMessage(sid, message("assistant", "kavak info"))
+}
+
+func testHistory(t *testing.T, s SessionStore) {
+	if hist := s.GetHistory("unknown"); len(hist) != 0 {
+		t.Errorf("history of an unknown session: %v", contents(hist))
+	}
+	startConversation(s, "s1")
+	s.AppendMessage("s1", message("user", "hola"))
+	s.AppendMessage("s1", message("assistant", "¡Hola! ¿En qué te ayudo?"))
+	s.AppendMessage("s2", message("user", "other session"))
+
+	hist := s.GetHistory("s1")
+	want := []string{"system prompt", "kavak info", "hola", "¡Hola! ¿En qué te ayudo?"}
+	if got := contents(hist); !slices.Equal(got, want) {
+		t.Errorf("history %q, want %q", got, want)
+	}
+	if hist[2].Role != "user" || hist[3].Role != "assistant" {
+		t.Errorf("roles %q and %q, want user and assistant", hist[2].Role, hist[3].Role)
+	}
+}
+
+func testTrim(t *testing.T, s SessionStore) {
+	startConversation(s, "s1")
+	for i := 1; i <= 5; i++ {
+		s.AppendMessage("s1", message("user", fmt.Sprint(i)))
+	}
+	want := []string{"system prompt", "kavak info", "3", "4", "5"}
+	if got := contents(s.GetHistory("s1")); !slices.Equal(got, want) {
+		t.Errorf("trimmed history %q, want %q", got, want)
+	}
+}
+
+func testLastCar(t *testing.T, s SessionStore) {
+	if _, ok := s.GetLastCar("s1"); ok {
+		t.Errorf("unknown session has a last car")
+	}
+	car := testCar
+	car.Embedding = []float32{0.1, 0.2}
+	s.SetLastCar("s1", car)
+	got, ok := s.GetLastCar("s1")
+	if !ok {
+		t.Fatalf("last car not stored")
+	}
+	got.Embedding = nil
+	if !reflect.DeepEqual(got, testCar) {
+		t.Errorf("last car %+v, want %+v", got, testCar)
+	}
+
+	newer := testCar
+	newer.StockID = "999"
+	s.SetLastCar("s1", newer)
+	if got, _ := s.GetLastCar("s1"); got.StockID != "999" {
+		t.Errorf("last car %s after replacing it, want 999", got.StockID)
+	}
+}
+
+func testState(t *testing.T, s SessionStore) {
+	recs := []catalog.Car{testCar, {StockID: "2", Make: "Toyota", Model: "RAV4", Price: 375999}}
+	terms := financing.Terms{DownPayment: 100000, Years: 4, Profile: financing.Good, MonthlyBudget: 9000, TradeIn: 50000}
+	trade := tradein.TradeIn{Car: tradein.Car{Make: "Nissan", Model: "Versa", Year: 2017}, Pending: "km"}
+
+	s.SetRecommendations("s1", recs)
+	s.SetPromptVersion("s1", "v2")
+	s.SetVariant("s1", "treatment")
+	s.SetLanguage("s1", i18n.English)
+	s.SetFinancingTerms("s1", terms)
+	s.SetTradeIn("s1", trade)
+	s.AddUsage("s1", usage.Totals{PromptTokens: 100, CompletionTokens: 20, CostUSD: 0.5, CostMXN: 9})
+	s.AddUsage("s1", usage.Totals{PromptTokens: 50, AudioSeconds: 12.5, CostUSD: 0.25, CostMXN: 4.5})
+
+	if got := s.GetRecommendations("s1"); !reflect.DeepEqual(got, recs) {
+		t.Errorf("recommendations %+v, want %+v", got, recs)
+	}
+	if got, ok := s.GetPromptVersion("s1"); !ok || got != "v2" {
+		t.Errorf("prompt version %q, %v", got, ok)
+	}
+	if got, ok := s.GetVariant("s1"); !ok || got != "treatment" {
+		t.Errorf("variant %q, %v", got, ok)
+	}
+	if got, ok := s.GetLanguage("s1"); !ok || got != i18n.English {
+		t.Errorf("language %q, %v", got, ok)
+	}
+	if got := s.GetFinancingTerms("s1"); got != terms {
+		t.Errorf("financing terms %+v, want %+v", got, terms)
+	}
+	if got := s.GetTradeIn("s1"); !reflect.DeepEqual(got, trade) {
+		t.Errorf("trade-in %+v, want %+v", got, trade)
+	}
+	want := usage.Totals{PromptTokens: 150, CompletionTokens: 20, AudioSeconds: 12.5, CostUSD: 0.75, CostMXN: 13.5}
+	if got, ok := s.GetUsage("s1"); !ok || got != want {
+		t.Errorf("usage %+v, %v, want %+v", got, ok, want)
+	}
+
+	if _, ok := s.GetPromptVersion("s2"); ok {
+		t.Errorf("another session has a prompt version")
+	}
+	if _, ok := s.GetUsage("s2"); ok {
+		t.Errorf("another session has usage")
+	}
+	if got := s.GetFinancingTerms("s2"); got != (financing.Terms{}) {
+		t.Errorf("another session has financing terms %+v", got)
+	}
+}
+
+func testProfile(t *testing.T, s SessionStore) {
+	p := customer.Profile{
+		Budget:    400000,
+		Makes:     []string{"Mazda"},
+		City:      "Monterrey",
+		Financing: true,
+		UpdatedAt: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	s.SetProfile("whatsapp:+5215512345678", p)
+	got, ok := s.GetProfile("whatsapp:+5215512345678")
+	if !ok || !reflect.DeepEqual(got, p) {
+		t.Errorf("profile %+v, %v, want %+v", got, ok, p)
+	}
+
+	// Profiles outlive the sessions.
+	s.DeleteHistory("whatsapp:+5215512345678")
+	if _, ok := s.GetProfile("whatsapp:+5215512345678"); !ok {
+		t.Errorf("deleting the session deleted the profile")
+	}
+	s.DeleteProfile("whatsapp:+5215512345678")
+	if _, ok := s.GetProfile("whatsapp:+5215512345678"); ok {
+		t.Errorf("profile still stored after deleting it")
+	}
+}
+
+func testActivity(t *testing.T, s SessionStore) {
+	if _, ok := s.Activity("s1"); ok {
+		t.Errorf("unknown session has activity")
+	}
+	before := time.Now().Add(-time.Second)
+	startConversation(s, "s1")
+	a, ok := s.Activity("s1")
+	if !ok {
+		t.Fatalf("no activity after appending messages")
+	}
+	if a.Started.Before(before.Truncate(time.Second)) || a.LastMessage.Before(a.Started) {
+		t.Errorf("activity %+v, want it to start after %s", a, before)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if ids := s.Expired(later, time.Time{}); !slices.Contains(ids, "s1") {
+		t.Errorf("idle sessions %v don't include s1", ids)
+	}
+	if ids := s.Expired(time.Time{}, later); !slices.Contains(ids, "s1") {
+		t.Errorf("old sessions %v don't include s1", ids)
+	}
+	if ids := s.Expired(before.Add(-time.Hour), before.Add(-time.Hour)); len(ids) != 0 {
+		t.Errorf("expired sessions %v, want none", ids)
+	}
+	if ids := s.Expired(time.Time{}, time.Time{}); len(ids) != 0 {
+		t.Errorf("expired sessions %v with both checks skipped", ids)
+	}
+}
+
+func testReset(t *testing.T, s SessionStore) {
+	startConversation(s, "s1")
+	s.SetLastCar("s1", testCar)
+	s.SetPromptVersion("s1", "v1")
+	s.SetLanguage("s1", i18n.Portuguese)
+	s.SetRecommendations("s1", []catalog.Car{testCar})
+	s.AddUsage("s1", usage.Totals{PromptTokens: 10})
+
+	s.ResetSession("s1", 0)
+
+	if hist := s.GetHistory("s1"); len(hist) != 0 {
+		t.Errorf("history after reset: %q", contents(hist))
+	}
+	if _, ok := s.GetPromptVersion("s1"); ok {
+		t.Errorf("prompt version kept after reset")
+	}
+	if _, ok := s.GetLanguage("s1"); ok {
+		t.Errorf("language kept after reset")
+	}
+	if recs := s.GetRecommendations("s1"); len(recs) != 0 {
+		t.Errorf("recommendations kept after reset")
+	}
+	if _, ok := s.GetUsage("s1"); ok {
+		t.Errorf("usage kept after reset")
+	}
+	if car, ok := s.GetLastCar("s1"); !ok || car.StockID != testCar.StockID {
+		t.Errorf("last car %+v, %v after reset, want it kept", car, ok)
+	}
+	a, ok := s.Activity("s1")
+	if !ok || !a.Started.IsZero() || a.LastMessage.IsZero() {
+		t.Errorf("activity %+v, %v after reset, want only the last message", a, ok)
+	}
+	if ids := s.Expired(time.Now().Add(time.Hour), time.Now().Add(time.Hour)); len(ids) != 0 {
+		t.Errorf("reset session listed as expired: %v", ids)
+	}
+	if n := s.Forget(time.Now().Add(24 * time.Hour)); n != 0 {
+		t.Errorf("forgot %d sessions reset to be kept until deleted", n)
+	}
+	if _, ok := s.GetLastCar("s1"); !ok {
+		t.Errorf("last car forgotten, want it kept until deleted")
+	}
+}
+
+// testRetention checks that a reset session is forgotten once its keep has
+// passed, unless a new conversation started; pass makes d go by for s.
+func testRetention(t *testing.T, s SessionStore, pass func(d time.Duration)) {
+	for _, sid := range []string{"gone", "back"} {
+		startConversation(s, sid)
+		s.SetLastCar(sid, testCar)
+		s.ResetSession(sid, time.Hour)
+	}
+	startConversation(s, "back")
+
+	pass(30 * time.Minute)
+	if _, ok := s.GetLastCar("gone"); !ok {
+		t.Errorf("last car forgotten before its keep")
+	}
+	pass(2 * time.Hour)
+	if _, ok := s.GetLastCar("gone"); ok {
+		t.Errorf("last car kept after its keep")
+	}
+	if _, ok := s.Activity("gone"); ok {
+		t.Errorf("activity kept after its keep")
+	}
+	if _, ok := s.GetLastCar("back"); !ok {
+		t.Errorf("a new conversation lost its last car")
+	}
+	if hist := s.GetHistory("back"); len(hist) != 2 {
+		t.Errorf("a new conversation has %d messages after the keep, want 2", len(hist))
+	}
+}
+
+func testDelete(t *testing.T, s SessionStore) {
+	startConversation(s, "s1")
+	startConversation(s, "s2")
+	s.SetLastCar("s1", testCar)
+	s.SetVariant("s1", "control")
+
+	s.DeleteHistory("s1")
+
+	if hist := s.GetHistory("s1"); len(hist) != 0 {
+		t.Errorf("history after delete: %q", contents(hist))
+	}
+	if _, ok := s.GetLastCar("s1"); ok {
+		t.Errorf("last car kept after delete")
+	}
+	if _, ok := s.GetVariant("s1"); ok {
+		t.Errorf("variant kept after delete")
+	}
+	if _, ok := s.Activity("s1"); ok {
+		t.Errorf("activity kept after delete")
+	}
+	if ids := s.Expired(time.Now().Add(time.Hour), time.Time{}); slices.Contains(ids, "s1") {
+		t.Errorf("deleted session listed as expired")
+	}
+	if hist := s.GetHistory("s2"); len(hist) != 2 {
+		t.Errorf("deleting s1 changed s2's history: %q", contents(hist))
+	}
+}
+
+// testConcurrentAppends checks that writes to one session from many
+// goroutines are neither lost nor reordered within each writer.
+func testConcurrentAppends(t *testing.T, s SessionStore) {
+	const writers, each = 8, 25
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				s.AppendMessage("s1", message("user", fmt.Sprintf("%d-%d", w, i)))
+				s.AddUsage("s1", usage.Totals{PromptTokens: 1, CompletionTokens: 2})
+			}
+		}()
+	}
+	wg.Wait()
+
+	hist := s.GetHistory("s1")
+	if len(hist) != writers*each {
+		t.Fatalf("%d messages, want %d", len(hist), writers*each)
+	}
+	next := make([]int, writers)
+	for _, m := range hist {
+		var w, i int
+		if _, err := fmt.Sscanf(m.Content, "%d-%d", &w, &i); err != nil {
+			t.Fatalf("unexpected message %q", m.Content)
+		}
+		if i != next[w] {
+			t.Fatalf("writer %d: message %d stored before %d", w, i, next[w])
+		}
+		next[w]++
+	}
+	want := usage.Totals{PromptTokens: writers * each, CompletionTokens: 2 * writers * each}
+	if got, _ := s.GetUsage("s1"); got != want {
+		t.Errorf("usage %+v, want %+v", got, want)
+	}
+}
+
+// testLock checks that a session's lock is held by one turn at a time, that
+// waiting for it can be canceled and that sessions don't wait for each
+// other.
+func testLock(t *testing.T, s SessionStore) {
+	var holders, most atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := s.Lock(context.Background(), "s1")
+			if err != nil {
+				t.Errorf("Lock: %v", err)
+				return
+			}
+			n := holders.Add(1)
+			for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+			}
+			time.Sleep(5 * time.Millisecond)
+			holders.Add(-1)
+			unlock()
+		}()
+	}
+	wg.Wait()
+	if most.Load() != 1 {
+		t.Errorf("%d turns held the lock at once", most.Load())
+	}
+
+	unlock, err := s.Lock(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := s.Lock(ctx, "s1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Lock of a held session = %v, want the deadline error", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	other, err := s.Lock(ctx, "s2")
+	if err != nil {
+		t.Fatalf("another session waited for s1: %v", err)
+	}
+	other()
+	unlock()
+	unlock() // releasing twice is harmless
+	again, err := s.Lock(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("Lock after release: %v", err)
+	}
+	again()
+}
@@ -0,0 +1,151 @@
+package tradein
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+)
+
+var (
+	yearRe      = regexp.MustCompile(`\b(19[89]\d|20[0-4]\d)\b`)
+	kmRe        = regexp.MustCompile(`(\d{1,3}(?:[,.]\d{3})+|\d+)\s*(mil|k)?\s*(km|kms|kilometros|kilometers|quilometros)\b`)
+	numberRe    = regexp.MustCompile(`^\D*(\d{1,3}(?:[,.]\d{3})+|\d+)\s*(mil|k)?\D*$`)
+	unknownRe   = regexp.MustCompile(`\b(no se|no lo se|ni idea|no recuerdo|don'?t know|not sure|nao sei)\b`)
+	fillerRe    = regexp.MustCompile(`^(es|it'?s|it is|e|tengo|i have|eu tenho)?\s*(un|una|el|la|a|an|um|uma|o)?\s+`)
+	accents     = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ñ", "n", "ã", "a", "õ", "o", "ç", "c", "ê", "e", "ô", "o")
+	maxFreeText = 6
+)
+
+// Parser reads the data of the customer's car from messages. Makes and
+// models are recognized from the catalog; an answer to a question about a
+// field the catalog doesn't know is taken as is.
+type Parser struct {
+	makes  map[string]string
+	models map[string][]string
+}
+
+func NewParser(cars []catalog.Car) *Parser {
+	p := &Parser{makes: make(map[string]string), models: make(map[string][]string)}
+	seen := make(map[string]bool)
+	for _, car := range cars {
+		mk := normalize(car.Make)
+		if mk == "" {
+			continue
+		}
+		p.makes[mk] = car.Make
+		if md := normalize(car.Model); md != "" && !seen[mk+"/"+md] {
+			seen[mk+"/"+md] = true
+			p.models[car.Make] = append(p.models[car.Make], car.Model)
+		}
+	}
+	for mk := range p.models {
+		// Longest first, so that "Grand Cherokee" wins over "Cherokee".
+		sort.Slice(p.models[mk], func(i, j int) bool { return len(p.models[mk][i]) > len(p.models[mk][j]) })
+	}
+	return p
+}
+
+// Parse returns car with the fields text gives, and whether it gave any.
+// pending is the field the customer was asked for.
+func (p *Parser) Parse(text string, car Car, pending string) (Car, bool) {
+	t := normalize(text)
+	found := false
+
+	if mk := p.findMake(t); mk != "" {
+		car.Make, found = mk, true
+	}
+	if car.Make != "" {
+		if md := p.findModel(t, car.Make); md != "" {
+			car.Model, found = md, true
+		}
+	}
+	if m := kmRe.FindStringSubmatch(t); m != nil {
+		car.KM, found = number(m[1], m[2]), true
+		t = strings.Replace(t, m[0], " ", 1)
+	}
+	if m := yearRe.FindString(t); m != "" {
+		car.Year, _ = strconv.Atoi(m)
+		found = true
+	}
+
+	if found || len(strings.Fields(t)) > maxFreeText {
+		return car, found
+	}
+	free := strings.TrimSpace(fillerRe.ReplaceAllString(strings.Trim(strings.TrimSpace(text), ".,;!¡?¿"), ""))
+	switch pending {
+	case FieldMake:
+		car.Make = free
+	case FieldModel:
+		car.Model = free
+	case FieldVersion:
+		if unknownRe.MatchString(t) {
+			car.Version = UnknownVersion
+		} else {
+			car.Version = free
+		}
+	case FieldKM:
+		m := numberRe.FindStringSubmatch(t)
+		if m == nil {
+			return car, false
+		}
+		car.KM = number(m[1], m[2])
+	default:
+		return car, false
+	}
+	return car, free != ""
+}
+
+// findMake returns the longest catalog make in t, so that "land rover" wins
+// over a shorter make inside it.
+func (p *Parser) findMake(t string) string {
+	best := ""
+	for mk := range p.makes {
+		if len(mk) > len(best) && containsWord(t, mk) {
+			best = mk
+		}
+	}
+	return p.makes[best]
+}
+
+func (p *Parser) findModel(t, mk string) string {
+	for _, md := range p.models[mk] {
+		if containsWord(t, normalize(md)) {
+			return md
+		}
+	}
+	return ""
+}
+
+// containsWord reports whether w appears in t as whole words.
+func containsWord(t, w string) bool {
+	for i := 0; ; {
+		j := strings.Index(t[i:], w)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(w)
+		if (start == 0 || !wordByte(t[start-1])) && (end == len(t) || !wordByte(t[end])) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func wordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b >= 0x80
+}
+
+func number(digits, thousands string) int {
+	n, _ := strconv.Atoi(strings.NewReplacer(",", "", ".", "").Replace(digits))
+	if thousands != "" {
+		n *= 1000
+	}
+	return n
+}
+
+func normalize(s string) string {
+	return accents.Replace(strings.ToLower(strings.TrimSpace(s)))
+}
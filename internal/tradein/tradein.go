@@ -0,0 +1,223 @@
+package tradein
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"carlospayan/agent-comercial-ai/internal/catalog"
+	"carlospayan/agent-comercial-ai/internal/config"
+)
+
+const (
+	ModelComparables = "comparables"
+
+	defaultDepreciation = 0.10
+	defaultKMAdjustment = 0.01
+	defaultMargin       = 0.20
+	defaultSpread       = 0.05
+)
+
+var ErrNoComparables = errors.New("no comparable cars in the catalog")
+
+// Fields of the customer's car, in the order the flow asks for them.
+const (
+	FieldMake    = "make"
+	FieldModel   = "model"
+	FieldYear    = "year"
+	FieldVersion = "version"
+	FieldKM      = "km"
+)
+
+// UnknownVersion is the version of a car whose owner doesn't know it.
+const UnknownVersion = "desconocida"
+
+// Car is the car a customer wants to trade in.
+type Car struct {
+	Make    string `json:"make,omitempty"`
+	Model   string `json:"model,omitempty"`
+	Year    int    `json:"year,omitempty"`
+	Version string `json:"version,omitempty"`
+	KM      int    `json:"km,omitempty"`
+}
+
+// Missing returns the fields still unknown, in the order to ask for them.
+func (c Car) Missing() []string {
+	var missing []string
+	if c.Make == "" {
+		missing = append(missing, FieldMake)
+	}
+	if c.Model == "" {
+		missing = append(missing, FieldModel)
+	}
+	if c.Year == 0 {
+		missing = append(missing, FieldYear)
+	}
+	if c.Version == "" {
+		missing = append(missing, FieldVersion)
+	}
+	if c.KM == 0 {
+		missing = append(missing, FieldKM)
+	}
+	return missing
+}
+
+// Valuation is the estimated price range of a trade-in. Offer is what Kavak
+// would pay, between Low and High.
+type Valuation struct {
+	Low         float64 `json:"low"`
+	High        float64 `json:"high"`
+	Offer       float64 `json:"offer"`
+	Comparables int     `json:"comparables"`
+	Method      string  `json:"method"`
+}
+
+// TradeIn is the state of a session's trade-in flow.
+type TradeIn struct {
+	Car Car `json:"car"`
+	// Pending is the field the last answer asked for; empty when the flow
+	// isn't waiting for one.
+	Pending   string     `json:"pending,omitempty"`
+	Valuation *Valuation `json:"valuation,omitempty"`
+}
+
+// Active reports whether the flow is collecting the car's data.
+func (t TradeIn) Active() bool {
+	return t.Pending != ""
+}
+
+// Valuer estimates what a car is worth.
+type Valuer interface {
+	Value(car Car) (Valuation, error)
+}
+
+// New returns the configured valuation model.
+func New(cfg config.TradeInConfig, cars []catalog.Car) Valuer {
+	switch cfg.Model {
+	case ModelComparables, "":
+	default:
+		log.Printf("tradein: unknown model %q, using %s", cfg.Model, ModelComparables)
+	}
+	c := &Comparables{
+		cars:         cars,
+		depreciation: cfg.Depreciation,
+		kmAdjustment: cfg.KMAdjustment,
+		margin:       cfg.Margin,
+		spread:       cfg.Spread,
+	}
+	if c.depreciation <= 0 {
+		c.depreciation = defaultDepreciation
+	}
+	if c.kmAdjustment <= 0 {
+		c.kmAdjustment = defaultKMAdjustment
+	}
+	if c.margin <= 0 {
+		c.margin = defaultMargin
+	}
+	if c.spread <= 0 {
+		c.spread = defaultSpread
+	}
+	return c
+}
+
+// Comparables values a car from the catalog cars of the same make and model
+// (or, failing that, make): each price is moved to the car's year with a
+// yearly depreciation and to its mileage, and the median is the retail
+// price. The offer is the retail price minus Kavak's margin.
+type Comparables struct {
+	cars         []catalog.Car
+	depreciation float64
+	kmAdjustment float64
+	margin       float64
+	spread       float64
+}
+
+func (v *Comparables) Value(car Car) (Valuation, error) {
+	method := "make_model"
+	comps := v.matching(car, true)
+	if len(comps) == 0 {
+		method = "make"
+		comps = v.matching(car, false)
+	}
+	if len(comps) == 0 {
+		return Valuation{}, ErrNoComparables
+	}
+	if same := sameVersion(comps, car.Version); len(same) > 0 {
+		comps = same
+	}
+
+	prices := make([]float64, 0, len(comps))
+	for _, comp := range comps {
+		price := comp.Price * math.Pow(1-v.depreciation, float64(comp.Year-car.Year))
+		kmFactor := 1 - v.kmAdjustment*float64(car.KM-comp.KM)/10000
+		price *= math.Max(0.7, math.Min(1.3, kmFactor))
+		prices = append(prices, price)
+	}
+	retail := median(prices)
+	spread := v.spread
+	if method == "make" {
+		spread *= 2
+	}
+	return Valuation{
+		Low:         thousands(retail * (1 - v.margin - spread)),
+		High:        thousands(retail * (1 - v.margin + spread)),
+		Offer:       thousands(retail * (1 - v.margin)),
+		Comparables: len(comps),
+		Method:      method,
+	}, nil
+}
+
+func (v *Comparables) matching(car Car, withModel bool) []catalog.Car {
+	var comps []catalog.Car
+	for _, c := range v.cars {
+		if !strings.EqualFold(c.Make, car.Make) {
+			continue
+		}
+		if withModel && !sameModel(c.Model, car.Model) {
+			continue
+		}
+		comps = append(comps, c)
+	}
+	return comps
+}
+
+func sameModel(a, b string) bool {
+	a, b = strings.ToLower(strings.TrimSpace(a)), strings.ToLower(strings.TrimSpace(b))
+	return a != "" && b != "" && (strings.Contains(a, b) || strings.Contains(b, a))
+}
+
+// sameVersion returns the comparables whose version contains every word of
+// version.
+func sameVersion(comps []catalog.Car, version string) []catalog.Car {
+	words := strings.Fields(strings.ToLower(version))
+	if len(words) == 0 || version == UnknownVersion {
+		return nil
+	}
+	var same []catalog.Car
+	for _, c := range comps {
+		v := strings.ToLower(c.Version)
+		all := true
+		for _, w := range words {
+			all = all && strings.Contains(v, w)
+		}
+		if all {
+			same = append(same, c)
+		}
+	}
+	return same
+}
+
+func median(xs []float64) float64 {
+	sort.Float64s(xs)
+	n := len(xs)
+	if n%2 == 1 {
+		return xs[n/2]
+	}
+	return (xs[n/2-1] + xs[n/2]) / 2
+}
+
+func thousands(x float64) float64 {
+	return math.Round(x/1000) * 1000
+}
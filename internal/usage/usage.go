@@ -0,0 +1,146 @@
+package usage
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/metrics"
+)
+
+// Totals are the running token and cost totals of one session.
+type Totals struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	AudioSeconds     float64 `json:"audio_seconds"`
+	CostUSD          float64 `json:"cost_usd"`
+	CostMXN          float64 `json:"cost_mxn"`
+}
+
+// Add returns the sum of t and o.
+func (t Totals) Add(o Totals) Totals {
+	return Totals{
+		PromptTokens:     t.PromptTokens + o.PromptTokens,
+		CompletionTokens: t.CompletionTokens + o.CompletionTokens,
+		AudioSeconds:     t.AudioSeconds + o.AudioSeconds,
+		CostUSD:          t.CostUSD + o.CostUSD,
+		CostMXN:          t.CostMXN + o.CostMXN,
+	}
+}
+
+type price struct {
+	promptPer1K     float64
+	completionPer1K float64
+	perMinute       float64
+}
+
+type scopeKey struct{}
+
+type scope struct {
+	sessionID string
+	endpoint  string
+	sink      Sink
+}
+
+// Sink keeps the totals of each session, e.g. the session store, so that
+// they live and expire with the session.
+type Sink interface {
+	// AddUsage adds t to the session's totals.
+	AddUsage(sessionID string, t Totals)
+}
+
+var (
+	mu       sync.Mutex
+	prices   = make(map[string]price)
+	usdToMXN float64
+	// unpriced holds the models without a price that were already logged.
+	unpriced = make(map[string]bool)
+)
+
+// Configure loads the price table used to turn tokens into an estimated cost.
+func Configure(cfg config.PricingConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+	usdToMXN = cfg.USDToMXN
+	prices = make(map[string]price, len(cfg.Models))
+	unpriced = make(map[string]bool)
+	for _, m := range cfg.Models {
+		prices[m.Model] = price{
+			promptPer1K:     m.PromptPer1KUSD,
+			completionPer1K: m.CompletionPer1KUSD,
+			perMinute:       m.PerMinuteUSD,
+		}
+	}
+}
+
+// WithScope tags ctx with the session and endpoint that OpenAI calls made
+// with it should be charged to. The session's totals are added to sink.
+func WithScope(ctx context.Context, sessionID, endpoint string, sink Sink) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope{sessionID: sessionID, endpoint: endpoint, sink: sink})
+}
+
+// Record accounts the tokens of one OpenAI response against the scope in ctx.
+// Calls without a scope are charged to the "background" endpoint.
+func Record(ctx context.Context, model string, promptTokens, completionTokens int) {
+	sc := scopeOf(ctx)
+	p, rate := priceOf(model)
+	cost := float64(promptTokens)/1000*p.promptPer1K + float64(completionTokens)/1000*p.completionPer1K
+
+	metrics.PromptTokens.WithLabelValues(model, sc.endpoint).Add(float64(promptTokens))
+	metrics.CompletionTokens.WithLabelValues(model, sc.endpoint).Add(float64(completionTokens))
+	metrics.EstimatedCostUSD.WithLabelValues(model, sc.endpoint).Add(cost)
+
+	sc.add(Totals{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		CostUSD:          cost,
+		CostMXN:          cost * rate,
+	})
+}
+
+// RecordAudio accounts seconds of audio transcribed by model, which is
+// priced by the minute, against the scope in ctx.
+func RecordAudio(ctx context.Context, model string, seconds float64) {
+	sc := scopeOf(ctx)
+	p, rate := priceOf(model)
+	cost := seconds / 60 * p.perMinute
+
+	metrics.AudioSeconds.WithLabelValues(model, sc.endpoint).Add(seconds)
+	metrics.EstimatedCostUSD.WithLabelValues(model, sc.endpoint).Add(cost)
+
+	sc.add(Totals{
+		AudioSeconds: seconds,
+		CostUSD:      cost,
+		CostMXN:      cost * rate,
+	})
+}
+
+func scopeOf(ctx context.Context) scope {
+	sc, _ := ctx.Value(scopeKey{}).(scope)
+	if sc.endpoint == "" {
+		sc.endpoint = "background"
+	}
+	return sc
+}
+
+// priceOf returns the price of model and the exchange rate. Models missing
+// from the price table cost nothing, which is logged once per model.
+func priceOf(model string) (price, float64) {
+	mu.Lock()
+	defer mu.Unlock()
+	p, ok := prices[model]
+	if !ok && !unpriced[model] {
+		unpriced[model] = true
+		log.Printf("usage: model %s has no price in pricing.models, its cost is counted as 0", model)
+	}
+	return p, usdToMXN
+}
+
+// add adds t to the totals of the scope's session, if it has one.
+func (sc scope) add(t Totals) {
+	if sc.sessionID == "" || sc.sink == nil {
+		return
+	}
+	sc.sink.AddUsage(sc.sessionID, t)
+}
@@ -0,0 +1,51 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+)
+
+type sink map[string]Totals
+
+func (s sink) AddUsage(sessionID string, t Totals) {
+	s[sessionID] = s[sessionID].Add(t)
+}
+
+func TestRecord(t *testing.T) {
+	Configure(config.PricingConfig{USDToMXN: 20, Models: []config.ModelPrice{
+		{Model: "gpt-4o-mini", PromptPer1KUSD: 0.00015, CompletionPer1KUSD: 0.0006},
+		{Model: "whisper-1", PerMinuteUSD: 0.006},
+	}})
+	s := sink{}
+	ctx := WithScope(context.Background(), "s1", "test", s)
+	Record(ctx, "gpt-4o-mini", 2000, 500)
+	RecordAudio(ctx, "whisper-1", 30)
+
+	got := s["s1"]
+	if got.PromptTokens != 2000 || got.CompletionTokens != 500 || got.AudioSeconds != 30 {
+		t.Errorf("totals %+v", got)
+	}
+	if want := 0.0003 + 0.0003 + 0.003; math.Abs(got.CostUSD-want) > 1e-9 || math.Abs(got.CostMXN-want*20) > 1e-9 {
+		t.Errorf("cost %.6f USD, %.6f MXN; want %.6f USD", got.CostUSD, got.CostMXN, want)
+	}
+}
+
+func TestUnpricedModelLoggedOnce(t *testing.T) {
+	Configure(config.PricingConfig{})
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+	for i := 0; i < 3; i++ {
+		Record(context.Background(), "gpt-unknown", 100, 100)
+	}
+	if n := strings.Count(out.String(), "gpt-unknown"); n != 1 {
+		t.Errorf("unpriced model logged %d times, want once", n)
+	}
+}
@@ -0,0 +1,77 @@
+package vision
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"carlospayan/agent-comercial-ai/internal/config"
+	"carlospayan/agent-comercial-ai/internal/llm"
+	"carlospayan/agent-comercial-ai/internal/media"
+)
+
+const defaultModel = "gpt-4o-mini"
+
+const prompt = `Observa la imagen que envió un cliente de Kavak. Responde ÚNICAMENTE con un objeto JSON:
+{"is_car": <true si la imagen muestra un auto>, "make": "<marca>", "model": "<modelo>", "body_type": "<sedán, SUV, hatchback, pickup, camioneta...>", "color": "<color>"}
+Deja vacío ("") lo que no puedas reconocer con seguridad; no adivines el modelo.`
+
+// Description is what the vision model recognized in a photo.
+type Description struct {
+	IsCar    bool   `json:"is_car"`
+	Make     string `json:"make"`
+	Model    string `json:"model"`
+	BodyType string `json:"body_type"`
+	Color    string `json:"color"`
+}
+
+// Query is the catalog search text for the photo.
+func (d Description) Query() string {
+	var parts []string
+	for _, p := range []string{d.Make, d.Model, d.BodyType, d.Color} {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Describer recognizes cars in photos with a vision-capable model.
+type Describer struct {
+	enabled bool
+	client  *llm.Client
+	model   string
+}
+
+func NewDescriber(cfg config.VisionConfig, client *llm.Client) *Describer {
+	model := cfg.Model
+	if model == "" {
+		model = defaultModel
+	}
+	return &Describer{
+		enabled: cfg.Enabled,
+		client:  client,
+		model:   model,
+	}
+}
+
+func (d *Describer) Enabled() bool {
+	return d != nil && d.enabled
+}
+
+// Describe asks the model what car the image shows.
+func (d *Describer) Describe(ctx context.Context, image media.File) (Description, error) {
+	answer, err := d.client.Vision(ctx, d.model, prompt, image.Data, image.ContentType)
+	if err != nil {
+		return Description{}, fmt.Errorf("error describing image: %w", err)
+	}
+	var desc Description
+	if err := json.Unmarshal([]byte(answer), &desc); err != nil {
+		return Description{}, fmt.Errorf("error reading image description: %w", err)
+	}
+	if desc.IsCar && desc.Query() == "" {
+		desc.IsCar = false
+	}
+	return desc, nil
+}